@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// markAnalyzed marks the struct type and the struct types of its fields, which are analyzed as part of it.
+func markAnalyzed(structType *ast.StructType, analyzed map[*ast.StructType]bool) {
+	analyzed[structType] = true
+	for _, field := range structType.Fields.List {
+		if nested, ok := field.Type.(*ast.StructType); ok {
+			markAnalyzed(nested, analyzed)
+		}
+	}
+}
+
+// anonymousStructName returns a unique name for the anonymous struct type at the top of the stack of nodes,
+// based on the nearest named declaration: "anonymous struct in cfg" for "var cfg struct{...}".
+// The name is unique in the scope.
+func anonymousStructName(stack []ast.Node, scope string, mapper map[string]*Structure) string {
+	context := ""
+	for i := len(stack) - 2; i >= 0 && context == ""; i-- {
+		switch typed := stack[i].(type) {
+		case *ast.ValueSpec:
+			context = typed.Names[0].Name
+			for j, value := range typed.Values {
+				if value == stack[i+1] && j < len(typed.Names) {
+					context = typed.Names[j].Name
+				}
+			}
+		case *ast.AssignStmt:
+			for j, value := range typed.Rhs {
+				if value != stack[i+1] || j >= len(typed.Lhs) {
+					continue
+				}
+				if ident, ok := typed.Lhs[j].(*ast.Ident); ok {
+					context = ident.Name
+				}
+			}
+		case *ast.Field:
+			if len(typed.Names) > 0 {
+				context = typed.Names[0].Name
+			}
+		case *ast.TypeSpec:
+			context = typed.Name.Name
+		case *ast.FuncDecl:
+			context = typed.Name.Name
+		}
+	}
+
+	name := "anonymous struct"
+	if context != "" {
+		name += " in " + context
+	}
+	unique := name
+	for i := 2; mapper[qualifyName(scope, unique)] != nil; i++ {
+		unique = fmt.Sprintf("%s #%d", name, i)
+	}
+	return unique
+}
+
+// usedInUnkeyedLiteral reports whether the struct type at the top of the stack of nodes is the type
+// of a composite literal with unkeyed elements, directly ("struct{...}{1, 2}") or as the element type
+// of a slice, array or map literal ("[]struct{...}{{1, 2}}").
+func usedInUnkeyedLiteral(stack []ast.Node) bool {
+	if len(stack) < 2 {
+		return false
+	}
+	structType := stack[len(stack)-1]
+	switch parent := stack[len(stack)-2].(type) {
+	case *ast.CompositeLit:
+		return parent.Type == structType && hasUnkeyedElements(parent)
+	case *ast.ArrayType, *ast.MapType:
+		if len(stack) < 3 {
+			return false
+		}
+		lit, ok := stack[len(stack)-3].(*ast.CompositeLit)
+		if !ok || lit.Type != parent {
+			return false
+		}
+		for _, elt := range lit.Elts {
+			var elided []ast.Expr
+			switch typed := parent.(type) {
+			case *ast.ArrayType:
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					elt = kv.Value
+				}
+				elided = append(elided, elt)
+			case *ast.MapType:
+				kv, ok := elt.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				if typed.Key == structType {
+					elided = append(elided, kv.Key)
+				}
+				if typed.Value == structType {
+					elided = append(elided, kv.Value)
+				}
+			}
+			for _, expr := range elided {
+				if elidedLit, ok := expr.(*ast.CompositeLit); ok && elidedLit.Type == nil && hasUnkeyedElements(elidedLit) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// hasUnkeyedElements reports whether the composite literal lists its elements without keys.
+func hasUnkeyedElements(lit *ast.CompositeLit) bool {
+	if len(lit.Elts) == 0 {
+		return false
+	}
+	_, keyed := lit.Elts[0].(*ast.KeyValueExpr)
+	return !keyed
+}
+
+// anonymousIdentity returns the identity of the anonymous struct type: its fields in their order.
+// The field order of an anonymous struct type is part of its type, identical anonymous struct types of a package
+// must be reordered together (see fixIdenticalTogether). Tags are ignored, so types which only differ by their tags
+// share the same identity as well.
+func anonymousIdentity(structType *ast.StructType) string {
+	return types.ExprString(structType)
+}
+
+// unkeyedAnonymousTypes returns the identities of the anonymous struct types used in composite literals with
+// unkeyed elements in the files, see usedInUnkeyedLiteral. These types cannot be reordered anywhere in the package.
+func unkeyedAnonymousTypes(files ...*ast.File) map[string]bool {
+	unkeyed := make(map[string]bool)
+	var stack []ast.Node
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			stack = append(stack, n)
+			if structType, ok := n.(*ast.StructType); ok && usedInUnkeyedLiteral(stack) {
+				unkeyed[anonymousIdentity(structType)] = true
+			}
+			return true
+		})
+	}
+	return unkeyed
+}
+
+// hasUnkeyedIdentity reports whether the struct type or one of its nested struct types is identical
+// to an anonymous struct type used in a composite literal with unkeyed elements.
+func hasUnkeyedIdentity(structType *ast.StructType, unkeyed map[string]bool) bool {
+	found := false
+	ast.Inspect(structType, func(n ast.Node) bool {
+		if nested, ok := n.(*ast.StructType); ok && unkeyed[anonymousIdentity(nested)] {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// fixIdenticalTogether returns the structures to fix without the anonymous structures whose identical
+// anonymous struct types are not all fixed, e.g. because one of them is in the baseline or hasn't changed,
+// since reordering only some of them would make their types different.
+func fixIdenticalTogether(structures, fixStructures []*Structure) []*Structure {
+	fixed := make(map[*Structure]bool, len(fixStructures))
+	for _, structure := range fixStructures {
+		fixed[structure] = true
+	}
+	partial := make(map[string]bool)
+	for _, structure := range structures {
+		if identity := structure.MetaData.Identity; identity != "" && !fixed[structure] {
+			partial[identity] = true
+		}
+	}
+	result := fixStructures[:0:0]
+	for _, structure := range fixStructures {
+		if !partial[structure.MetaData.Identity] {
+			result = append(result, structure)
+		}
+	}
+	return result
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// anonymousSource declares anonymous structures in all supported contexts
+const anonymousSource = `package models
+
+var cfg struct {
+	a bool
+	b int64
+	c bool
+}
+
+var byName = map[string]struct {
+	a bool
+	b int64
+	c bool
+}{"x": {a: true}}
+
+type List []struct {
+	a bool
+	b int64
+	c bool
+}
+
+func handle(opts struct {
+	a bool
+	b int64
+	c bool
+}) {
+	items := []struct {
+		a bool
+		b int64
+		c bool
+	}{{a: true}}
+	_ = items
+}
+
+var unkeyed = []struct {
+	x bool
+	y int64
+	z bool
+}{{true, 1, false}}
+`
+
+// TestAnonymousStructures tests that anonymous structures outside type declarations are analyzed and fixed.
+func TestAnonymousStructures(t *testing.T) {
+	structures, _, err := ParseStrings(anonymousSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, structure := range structures {
+		names = append(names, structure.Name)
+	}
+	expected := "anonymous struct in cfg, anonymous struct in byName, anonymous struct in List, anonymous struct in opts, anonymous struct in items"
+	if strings.Join(names, ", ") != expected {
+		t.Errorf("Unexpected structures %q; want %q", strings.Join(names, ", "), expected)
+	}
+
+	for _, scoped := range []bool{false, true} {
+		var out bytes.Buffer
+		opts := fileProcessingOptions{out: &out, fixMode: true, scopedFormat: scoped}
+		result, findings, err := processSource("models.go", []byte(anonymousSource), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(findings) != 5 {
+			t.Errorf("Expected 5 findings, got %d:\n%s", len(findings), out.String())
+		}
+		fixed := strings.Count(string(result), "b int64\n\ta bool\n\tc bool\n") +
+			strings.Count(string(result), "b int64\n\t\ta bool\n\t\tc bool\n")
+		if fixed != 5 {
+			t.Errorf("Expected 5 fixed structures (scoped: %v), got %d:\n%s", scoped, fixed, result)
+		}
+		if !strings.HasSuffix(string(result), "var unkeyed = []struct {\n\tx bool\n\ty int64\n\tz bool\n}{{true, 1, false}}\n") {
+			t.Errorf("Expected the structure of the unkeyed literal to be untouched:\n%s", result)
+		}
+	}
+}
+
+// checkSource type-checks the Go source.
+func checkSource(t *testing.T, source []byte) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "models.go", source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := new(types.Config).Check("models", fset, []*ast.File{file}, nil); err != nil {
+		t.Errorf("Fixed source doesn't compile: %v\n%s", err, source)
+	}
+}
+
+// TestIdenticalAnonymousStructures tests that identical anonymous struct types are reordered together,
+// and not at all when one of them is used in a composite literal with unkeyed elements.
+func TestIdenticalAnonymousStructures(t *testing.T) {
+	unkeyed := `package models
+
+func f(p struct{a bool; b int64; c bool}) {}
+
+func g() {
+	f(struct{a bool; b int64; c bool}{true, 1, false})
+}
+`
+	var out bytes.Buffer
+	opts := fileProcessingOptions{out: &out, fixMode: true}
+	result, findings, err := processSource("models.go", []byte(unkeyed), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 || result != nil {
+		t.Errorf("Expected the parameter to be untouched, got %d findings:\n%s", len(findings), result)
+	}
+
+	keyed := `package models
+
+func f(p struct{a bool; b int64; c bool}) {}
+
+func g() {
+	f(struct{a bool; b int64; c bool}{a: true, b: 1})
+}
+`
+	result, findings, err = processSource("models.go", []byte(keyed), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 || strings.Count(strings.ReplaceAll(string(result), "\t", ""), "b int64\na bool\nc bool\n") != 2 {
+		t.Errorf("Expected both structures to be fixed, got %d findings:\n%s", len(findings), result)
+	}
+	checkSource(t, result)
+}
+
+// TestFixIdenticalTogether tests that identical anonymous structures are only fixed if all of them are.
+func TestFixIdenticalTogether(t *testing.T) {
+	param := &Structure{Path: "f.p", MetaData: &MetaData{Identity: "struct{a bool; b int64}"}}
+	literal := &Structure{Path: "g.literal", MetaData: &MetaData{Identity: "struct{a bool; b int64}"}}
+	cfg := &Structure{Path: "cfg", MetaData: &MetaData{Identity: "struct{c bool; d int64}"}}
+	named := &Structure{Path: "Named", MetaData: &MetaData{}}
+	structures := []*Structure{param, literal, cfg, named}
+
+	fixed := fixIdenticalTogether(structures, []*Structure{param, cfg, named})
+	var paths []string
+	for _, structure := range fixed {
+		paths = append(paths, structure.Path)
+	}
+	if strings.Join(paths, ", ") != "cfg, Named" {
+		t.Errorf("fixIdenticalTogether() = %q; want %q", strings.Join(paths, ", "), "cfg, Named")
+	}
+	if fixed := fixIdenticalTogether(structures, structures); len(fixed) != 4 {
+		t.Errorf("fixIdenticalTogether() fixed %d structures; want 4", len(fixed))
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultAssertTestFile is the default name of the generated assertions file
+const defaultAssertTestFile = "zz_gofield_layout_test.go"
+
+// defaultAssertFile is the default name of the generated assertions file when a build tag is given
+const defaultAssertFile = "zz_gofield_layout.go"
+
+// generateAssertions generates the source of a file with compile-time assertions of the layouts:
+// the build fails when the size, alignment or field offsets of a structure differ from the layout.
+//
+//	var _ [24]byte = [unsafe.Sizeof(User{})]byte{}
+//	var _ [8]byte = [unsafe.Alignof(User{})]byte{}
+//	var _ [8]byte = [unsafe.Offsetof(User{}.ID)]byte{}
+//
+// Generic types are skipped, since their layout depends on the type arguments, as well as partially guessed layouts.
+// Layouts should be checked against the compiler first, see verifiedLayouts.
+func generateAssertions(pkgName, buildTag string, layouts []structLayout) ([]byte, int, error) {
+	var buf bytes.Buffer
+	if buildTag != "" {
+		fmt.Fprintf(&buf, "//go:build %s\n\n", buildTag)
+	}
+	fmt.Fprintf(&buf, "// Code generated by gofield assert. DO NOT EDIT.\n\npackage %s\n\nimport \"unsafe\"\n", pkgName)
+
+	count := 0
+	for _, layout := range layouts {
+		if layout.generic || layout.partial {
+			continue
+		}
+		value := layout.Type + "{}"
+		fmt.Fprintf(&buf, "\n// %s\n", layout.Type)
+		fmt.Fprintf(&buf, "var _ [%d]byte = [unsafe.Sizeof(%s)]byte{}\n", layout.Size, value)
+		fmt.Fprintf(&buf, "var _ [%d]byte = [unsafe.Alignof(%s)]byte{}\n", layout.Align, value)
+		for _, field := range layout.Fields {
+			if name := field.selector(); name != "" {
+				fmt.Fprintf(&buf, "var _ [%d]byte = [unsafe.Offsetof(%s.%s)]byte{}\n", field.Offset, value, name)
+			}
+		}
+		count++
+	}
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot format assertions: %w", err)
+	}
+	return source, count, nil
+}
+
+// verifiedLayouts returns the layouts of the package which can be asserted: layouts which are neither generic
+// nor partially guessed, and match the ones computed by the compiler (see runVerifyTest).
+// Skipped layouts are returned with the reason. The output file is left out of the package, it may contain outdated
+// assertions.
+func verifiedLayouts(pkg *packageLayouts, output string) (verified []structLayout, skipped map[string]string, err error) {
+	skipped = make(map[string]string)
+	var candidates []structLayout
+	for _, layout := range pkg.layouts {
+		switch {
+		case layout.generic:
+		case layout.partial:
+			skipped[layout.Type] = "fields of unknown or zero size"
+		default:
+			candidates = append(candidates, layout)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, skipped, nil
+	}
+
+	source, _, err := generateVerifyTest(pkg.name, candidates)
+	if err != nil {
+		return nil, nil, err
+	}
+	testOutput, err := runVerifyTest(pkg.dir, source, output)
+	if err != nil {
+		return nil, nil, err
+	}
+	actual, err := parseVerifyOutput(testOutput)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, layout := range candidates {
+		actualLayout, ok := actual[layout.Type]
+		if !ok {
+			skipped[layout.Type] = "not computed by the compiler"
+			continue
+		}
+		if mismatches := verifyLayout(layout, actualLayout); len(mismatches) > 0 {
+			skipped[layout.Type] = "differs from the compiler: " + strings.Join(mismatches, ", ")
+			continue
+		}
+		verified = append(verified, layout)
+	}
+	return verified, skipped, nil
+}
+
+// runAssert runs the "assert" command: generates a file with compile-time layout assertions in every package folder.
+func runAssert(args []string) int {
+	fs := newCommandFlagSet("assert", "gofield assert [--files ./...] [--types A,B] [--output zz_gofield_layout_test.go] [--tag gofield_layout]")
+	discovery := addDiscoveryFlags(fs, ".")
+	typesFlag := fs.String("types", "", "Comma-separated list of structures to assert, by name or qualified name (default: all)")
+	outputFlag := fs.String("output", "", "Name of the generated file in every package folder (default: "+defaultAssertTestFile+", or "+defaultAssertFile+" with --tag)")
+	tagFlag := fs.String("tag", "", "Generate a non-test file behind the given build tag")
+	typesFileFlag := addTypesFileFlag(fs)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if err := useTypesFile(*typesFileFlag); err != nil {
+		return commandErrorf("Cannot load types file: %v\n", err)
+	}
+
+	output := *outputFlag
+	if output == "" {
+		output = defaultAssertTestFile
+		if *tagFlag != "" {
+			output = defaultAssertFile
+		}
+	}
+	if filepath.Base(output) != output || !strings.HasSuffix(output, ".go") {
+		return commandErrorf("Invalid output %q: expected a Go file name\n", output)
+	}
+
+	files, err := discovery.findFiles()
+	if err != nil {
+		return commandErrorf("%v\n", err)
+	}
+	packages, err := collectPackageLayouts(files, splitAndTrim(*typesFlag))
+	if err != nil {
+		return commandErrorf("%v\n", err)
+	}
+	for _, pkg := range packages {
+		// Assertions are only generated for layouts checked against the compiler
+		layouts, skipped, err := verifiedLayouts(pkg, output)
+		if err != nil {
+			return commandErrorf("Cannot verify layouts of '%s' with the compiler: %v\n", pkg.dir, err)
+		}
+		for _, layout := range pkg.layouts {
+			if reason, ok := skipped[layout.Type]; ok {
+				fmt.Printf("%s: skipped, %s\n", layout.location(), reason)
+			}
+		}
+		source, count, err := generateAssertions(pkg.name, *tagFlag, layouts)
+		if err != nil {
+			return commandErrorf("Cannot generate assertions for '%s': %v\n", pkg.dir, err)
+		}
+		if count == 0 {
+			continue
+		}
+		path := filepath.Join(pkg.dir, output)
+		if err := os.WriteFile(path, source, 0644); err != nil {
+			return commandErrorf("Cannot write assertions: %v\n", err)
+		}
+		fmt.Printf("%s: %d structures\n", path, count)
+	}
+	return 0
+}
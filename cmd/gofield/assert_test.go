@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEmbeddedFieldName tests the names of embedded fields used in offset assertions.
+func TestEmbeddedFieldName(t *testing.T) {
+	tests := map[string]string{
+		"Base":            "Base",
+		"*Base":           "Base",
+		"time.Time":       "Time",
+		"*sync.Mutex":     "Mutex",
+		"List[int]":       "List",
+		"*pkg.Set[K, V]":  "Set",
+		"atomic.Int64":    "Int64",
+		"Node[pkg.Value]": "Node",
+	}
+	for typeStr, expected := range tests {
+		if got := embeddedFieldName(typeStr); got != expected {
+			t.Errorf("embeddedFieldName(%q) = %q; want %q", typeStr, got, expected)
+		}
+	}
+}
+
+// TestGenerateAssertions tests the generated compile-time assertions.
+func TestGenerateAssertions(t *testing.T) {
+	layouts, err := fileLayouts("models.go", "example.com/models", []byte(`package models
+
+type User struct {
+	*Base
+	ID     int64
+	_      [4]byte
+	Active bool
+}
+
+type Marker struct {
+	n int64
+	_ struct{}
+}
+
+type List[T any] struct {
+	items []T
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, count, err := generateAssertions("models", "gofield_layout", layouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Expected assertions for 1 structure, got %d", count)
+	}
+	for _, expected := range []string{
+		"//go:build gofield_layout\n\n// Code generated by gofield assert. DO NOT EDIT.\n\npackage models\n",
+		"var _ [24]byte = [unsafe.Sizeof(User{})]byte{}\n",
+		"var _ [8]byte = [unsafe.Alignof(User{})]byte{}\n",
+		"var _ [0]byte = [unsafe.Offsetof(User{}.Base)]byte{}\n",
+		"var _ [8]byte = [unsafe.Offsetof(User{}.ID)]byte{}\n",
+		"var _ [20]byte = [unsafe.Offsetof(User{}.Active)]byte{}\n",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Errorf("Expected %q in generated source:\n%s", expected, source)
+		}
+	}
+	if strings.Contains(string(source), "List") || strings.Contains(string(source), "Marker") || strings.Contains(string(source), "}._") {
+		t.Errorf("Generic types, layouts with zero size fields and blank fields must be skipped:\n%s", source)
+	}
+}
+
+// TestAssertCommand tests that only layouts checked against the compiler are asserted.
+func TestAssertCommand(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/assert\n\ngo 1.21\n",
+		"models.go": `package models
+
+import "time"
+
+type User struct {
+	Active bool
+	ID     int64
+}
+
+type Stamped struct {
+	At time.Time
+	ok bool
+}
+
+type Marker struct {
+	n int64
+	_ struct{}
+}
+`,
+		// Outdated assertions are replaced
+		defaultAssertTestFile: "package models\n\nvar _ [1]byte = [2]byte{}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code := runAssert([]string{"--files", dir}); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	source, err := os.ReadFile(filepath.Join(dir, defaultAssertTestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(source), "unsafe.Sizeof(User{})") {
+		t.Errorf("Expected assertions for User:\n%s", source)
+	}
+	if strings.Contains(string(source), "Stamped") || strings.Contains(string(source), "Marker") {
+		t.Errorf("Layouts with fields of unknown or zero size must be skipped:\n%s", source)
+	}
+	cmd := exec.Command("go", "vet", ".")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("Generated assertions do not compile: %v\n%s", err, output)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupsDir is the journal folder with the backups of --fix runs, relative to the root folder, see journalDir
+var backupsDir = filepath.Join(".gofield", "backups")
+
+// backupVersion is the version of the backup manifest format
+const backupVersion = 1
+
+// backupManifestName is the name of the manifest file in the folder of a run
+const backupManifestName = "manifest.json"
+
+// backupFile describes a file backed up before a fix
+type backupFile struct {
+	// Path is the absolute path of the fixed file
+	Path string `json:"path"`
+	// Backup is the name of the file with the original content in the folder of the run
+	Backup string `json:"backup"`
+	// OriginalHash is the SHA-256 of the original content
+	OriginalHash string `json:"original_sha256"`
+	// FixedHash is the SHA-256 of the fixed content, used to detect changes made after the fix
+	FixedHash string `json:"fixed_sha256"`
+}
+
+// backupManifest describes the files backed up by a --fix run
+type backupManifest struct {
+	Version int          `json:"version"`
+	RunID   string       `json:"run_id"`
+	Created time.Time    `json:"created"`
+	Files   []backupFile `json:"files"`
+}
+
+// journalDir returns the journal folder, anchored to the root of the git repository of the current folder,
+// or to the root of its module outside of repositories, so runs can be undone from any folder.
+func journalDir() string {
+	if filepath.IsAbs(backupsDir) {
+		return backupsDir
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return backupsDir
+	}
+	if output, err := runGit("rev-parse", "--show-toplevel"); err == nil && strings.TrimSpace(output) != "" {
+		root = strings.TrimSpace(output)
+	} else if moduleRoot := findModuleRoot(root); moduleRoot != "" {
+		root = moduleRoot
+	}
+	return filepath.Join(root, backupsDir)
+}
+
+// hashData returns the hex-encoded SHA-256 of the data.
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// backupRewrites stores the current contents of the files about to be rewritten in a new run folder
+// of the journal, with a manifest. Returns the run ID.
+func backupRewrites(rewrites []rewrite, now time.Time) (string, error) {
+	journal := journalDir()
+	runID := now.Format("20060102-150405")
+	runDir := filepath.Join(journal, runID)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(runDir); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		runID = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), i)
+		runDir = filepath.Join(journal, runID)
+	}
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return "", fmt.Errorf("cannot create backup folder: %w", err)
+	}
+
+	manifest := backupManifest{
+		Version: backupVersion,
+		RunID:   runID,
+		Created: now,
+		Files:   make([]backupFile, 0, len(rewrites)),
+	}
+	for i, item := range rewrites {
+		absPath, err := filepath.Abs(item.path)
+		if err != nil {
+			return "", err
+		}
+		original, err := os.ReadFile(item.path)
+		if err != nil {
+			return "", fmt.Errorf("cannot read file '%s': %w", item.path, err)
+		}
+		name := fmt.Sprintf("%04d_%s", i+1, filepath.Base(item.path))
+		if err := os.WriteFile(filepath.Join(runDir, name), original, 0644); err != nil {
+			return "", fmt.Errorf("cannot back up file '%s': %w", item.path, err)
+		}
+		manifest.Files = append(manifest.Files, backupFile{
+			Path:         absPath,
+			Backup:       name,
+			OriginalHash: hashData(original),
+			FixedHash:    hashData(item.data),
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("cannot encode backup manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, backupManifestName), append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("cannot write backup manifest: %w", err)
+	}
+	return runID, nil
+}
+
+// loadBackupManifest reads the manifest of a run.
+func loadBackupManifest(runID string) (*backupManifest, error) {
+	data, err := os.ReadFile(filepath.Join(journalDir(), runID, backupManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read backup manifest: %w", err)
+	}
+	var manifest backupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("cannot parse backup manifest: %w", err)
+	}
+	if manifest.Version != backupVersion {
+		return nil, fmt.Errorf("unsupported backup manifest version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// listBackupRuns returns the IDs of the backed up runs, oldest first.
+func listBackupRuns() ([]string, error) {
+	journal := journalDir()
+	entries, err := os.ReadDir(journal)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read backups: %w", err)
+	}
+	var runs []string
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(journal, entry.Name(), backupManifestName)); entry.IsDir() && err == nil {
+			runs = append(runs, entry.Name())
+		}
+	}
+	sort.Strings(runs)
+	return runs, nil
+}
+
+// undoRun restores the original contents of the files fixed by the run, then removes the run from the journal.
+// Nothing is restored if any file has been modified (or removed) since the fix.
+func undoRun(runID string) ([]string, error) {
+	manifest, err := loadBackupManifest(runID)
+	if err != nil {
+		return nil, err
+	}
+	runDir := filepath.Join(journalDir(), runID)
+	var modified []string
+	rewrites := make([]rewrite, 0, len(manifest.Files))
+	for _, file := range manifest.Files {
+		current, err := os.ReadFile(file.Path)
+		if err != nil || hashData(current) != file.FixedHash {
+			modified = append(modified, file.Path)
+			continue
+		}
+		original, err := os.ReadFile(filepath.Join(runDir, file.Backup))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read backup of '%s': %w", file.Path, err)
+		}
+		if hashData(original) != file.OriginalHash {
+			return nil, fmt.Errorf("backup of '%s' is corrupted", file.Path)
+		}
+		rewrites = append(rewrites, rewrite{path: file.Path, data: original})
+	}
+	if len(modified) > 0 {
+		return modified, fmt.Errorf("%d files have been modified since the fix", len(modified))
+	}
+	if err := writeRewrites(rewrites); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(runDir); err != nil {
+		return nil, fmt.Errorf("cannot remove backup: %w", err)
+	}
+	return nil, nil
+}
+
+// runUndo runs the "undo" command: restores the files fixed by a --fix --backup run, the latest one by default.
+func runUndo(args []string) int {
+	fs := newCommandFlagSet("undo", "gofield undo [--list] [run-id]")
+	listFlag := fs.Bool("list", false, "List the runs which can be undone")
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+
+	runs, err := listBackupRuns()
+	if err != nil {
+		return commandErrorf("%v\n", err)
+	}
+	if *listFlag {
+		for _, runID := range runs {
+			manifest, err := loadBackupManifest(runID)
+			if err != nil {
+				return commandErrorf("Cannot load run %s: %v\n", runID, err)
+			}
+			fmt.Printf("%s  %d files\n", runID, len(manifest.Files))
+		}
+		return 0
+	}
+
+	runID := fs.Arg(0)
+	if runID == "" {
+		if len(runs) == 0 {
+			return commandErrorf("No backups found in %s\n", journalDir())
+		}
+		runID = runs[len(runs)-1]
+	}
+	modified, err := undoRun(runID)
+	if len(modified) > 0 {
+		log.Printf("Cannot undo run %s, files have been modified since the fix:\n-- %s\n", runID, strings.Join(modified, "\n-- "))
+		return exitCodeErrors
+	}
+	if err != nil {
+		return commandErrorf("Cannot undo run %s: %v\n", runID, err)
+	}
+	fmt.Printf("Restored files of run %s\n", runID)
+	return 0
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBackupAndUndo tests that files fixed with a backup can be restored unless modified since the fix.
+func TestBackupAndUndo(t *testing.T) {
+	dir := t.TempDir()
+	defer func(dir string) { backupsDir = dir }(backupsDir)
+	backupsDir = filepath.Join(dir, ".gofield", "backups")
+
+	path := filepath.Join(dir, "models.go")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func() string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	write("original")
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	fix := func() string {
+		rewrites := []rewrite{{path: path, data: []byte("fixed")}}
+		runID, err := backupRewrites(rewrites, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeRewrites(rewrites); err != nil {
+			t.Fatal(err)
+		}
+		return runID
+	}
+
+	runID := fix()
+	if runID != "20240501-103000" {
+		t.Errorf("Unexpected run ID %q", runID)
+	}
+	if _, err := undoRun(runID); err != nil {
+		t.Fatal(err)
+	}
+	if content := read(); content != "original" {
+		t.Errorf("Expected the original content to be restored, got %q", content)
+	}
+	if runs, _ := listBackupRuns(); len(runs) != 0 {
+		t.Errorf("Expected the run to be removed after undo, got %v", runs)
+	}
+
+	// Runs of the same second get distinct IDs
+	runID = fix()
+	write("original")
+	if secondRunID := fix(); secondRunID != runID+"-2" {
+		t.Errorf("Unexpected run ID of the second run %q", secondRunID)
+	}
+
+	// Files modified since the fix are not restored
+	write("modified")
+	modified, err := undoRun(runID + "-2")
+	if err == nil || len(modified) != 1 || modified[0] != path {
+		t.Errorf("Expected undo to be refused for the modified file, got %v, %v", modified, err)
+	}
+	if content := read(); content != "modified" {
+		t.Errorf("Expected the modified file to be untouched, got %q", content)
+	}
+}
+
+// TestJournalDir tests that the journal is anchored to the module root rather than the current folder.
+func TestJournalDir(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	subDir := filepath.Join(dir, "internal", "models")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(subDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workDir)
+
+	if journal := journalDir(); journal != filepath.Join(dir, backupsDir) {
+		t.Errorf("journalDir() = %q; want %q", journal, filepath.Join(dir, backupsDir))
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// baselineVersion is the version of the baseline file format
+const baselineVersion = 1
+
+// baselineEntry is a known finding recorded in a baseline file.
+//
+// Entries are keyed by package, type path and field signature rather than by line numbers,
+// so they survive unrelated edits of the file, but not changes of the structure itself.
+type baselineEntry struct {
+	Package string `json:"package"`
+	Type    string `json:"type"`
+	Fields  string `json:"fields"`
+	// Saving is the number of bytes which can be freed, for information only
+	Saving uintptr `json:"saving"`
+	// MaxSize is the "//gofield:maxsize" budget of the structure, for information only
+	MaxSize uintptr `json:"max_size,omitempty"`
+}
+
+// key returns the key used to match the entry with findings.
+func (e baselineEntry) key() string {
+	return e.Package + "\x00" + e.Type + "\x00" + e.Fields
+}
+
+// baselineFile is the content of a baseline file
+type baselineFile struct {
+	Version  int             `json:"version"`
+	Findings []baselineEntry `json:"findings"`
+}
+
+// baseline is a set of known findings loaded from a baseline file.
+// It keeps track of matched entries and analyzed structures to detect stale ones.
+type baseline struct {
+	entries map[string]baselineEntry
+	matched map[string]bool
+	// analyzed contains the analyzed structures by package and type path, see addStructure
+	analyzed map[string]bool
+}
+
+// newBaselineEntry creates a baseline entry for the finding.
+func newBaselineEntry(item finding) baselineEntry {
+	entry := baselineEntry{
+		Package: item.pkg,
+		Type:    item.structure.Path,
+		Fields:  item.signature,
+		MaxSize: item.structure.MetaData.MaxSize,
+	}
+	if item.optimizable {
+		entry.Saving = item.structure.MetaData.BeforeSize - item.structure.MetaData.AfterSize
+	}
+	return entry
+}
+
+// loadBaseline reads a baseline file.
+func loadBaseline(path string) (*baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read baseline: %w", err)
+	}
+	var file baselineFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("cannot parse baseline: %w", err)
+	}
+	if file.Version != baselineVersion {
+		return nil, fmt.Errorf("unsupported baseline version %d", file.Version)
+	}
+	b := &baseline{
+		entries:  make(map[string]baselineEntry, len(file.Findings)),
+		matched:  make(map[string]bool),
+		analyzed: make(map[string]bool),
+	}
+	for _, entry := range file.Findings {
+		b.entries[entry.key()] = entry
+	}
+	return b, nil
+}
+
+// writeBaseline writes the findings to a baseline file.
+func writeBaseline(path string, findings []finding) error {
+	file := baselineFile{
+		Version:  baselineVersion,
+		Findings: make([]baselineEntry, 0, len(findings)),
+	}
+	for _, item := range findings {
+		file.Findings = append(file.Findings, newBaselineEntry(item))
+	}
+	sort.Slice(file.Findings, func(i, j int) bool {
+		return file.Findings[i].key() < file.Findings[j].key()
+	})
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode baseline: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write baseline: %w", err)
+	}
+	return nil
+}
+
+// structureKey returns the key of a structure of a package, matching the entries of the structure.
+func structureKey(pkg, typePath string) string {
+	return pkg + "\x00" + typePath
+}
+
+// addStructure records that the structure has been analyzed. Only entries of analyzed structures can become stale:
+// structures which are not selected (--since, --staged) or whose findings are below thresholds are not recorded.
+func (b *baseline) addStructure(pkg, typePath string) {
+	b.analyzed[structureKey(pkg, typePath)] = true
+}
+
+// contains checks if the finding is recorded in the baseline and marks the matching entry as used.
+func (b *baseline) contains(item finding) bool {
+	key := newBaselineEntry(item).key()
+	if _, ok := b.entries[key]; !ok {
+		return false
+	}
+	b.matched[key] = true
+	return true
+}
+
+// stale returns the entries of analyzed structures which did not match any finding:
+// the structures have been optimized or changed since the baseline was written.
+func (b *baseline) stale() []baselineEntry {
+	var entries []baselineEntry
+	for key, entry := range b.entries {
+		if b.analyzed[structureKey(entry.Package, entry.Type)] && !b.matched[key] {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key() < entries[j].key()
+	})
+	return entries
+}
+
+// fieldSignature describes the fields of a structure in their order, including nested anonymous structures.
+//
+//	type A struct {
+//		time.Time
+//		F1, F2 bool
+//		F3     struct{ I int }
+//	}
+//
+// is described as "time.Time; F1 bool; F2 bool; F3 struct{I int}".
+func fieldSignature(elem *Structure) string {
+	if elem == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(elem.NestedFields))
+	for _, field := range elem.NestedFields {
+		typeStr := field.StringType
+		if field.IsStructure && !isValidCustomTypeName(field.StringType) {
+			typeStr = "struct{" + fieldSignature(field) + "}"
+		}
+		if field.Name == "" || strings.HasPrefix(field.Name, "!") {
+			parts = append(parts, typeStr)
+		} else {
+			parts = append(parts, field.Name+" "+typeStr)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// modulePaths caches module paths by module root folder
+var modulePaths = map[string]string{}
+
+// packageImportPath returns the import path of the package the file belongs to.
+//
+// The import path is built from the nearest go.mod file. Files outside of modules are identified
+// by their folder. External test packages get the "_test" suffix.
+func packageImportPath(path string, fileData []byte) string {
+	importPath := folderImportPath(path)
+	if isExternalTestPackage(path, fileData) {
+		importPath += "_test"
+	}
+	return importPath
+}
+
+// folderImportPath returns the import path of the folder of the file, see packageImportPath.
+func folderImportPath(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	dir := filepath.Dir(absPath)
+
+	importPath := filepath.ToSlash(dir)
+	if root := findModuleRoot(dir); root != "" {
+		if modulePath := readModulePath(root); modulePath != "" {
+			rel, _ := filepath.Rel(root, dir)
+			importPath = modulePath
+			if rel != "." {
+				importPath += "/" + filepath.ToSlash(rel)
+			}
+		}
+	}
+	return importPath
+}
+
+// isExternalTestPackage checks if the source belongs to an external test package ("package xxx_test").
+func isExternalTestPackage(path string, fileData []byte) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), path, fileData, parser.PackageClauseOnly)
+	return err == nil && strings.HasSuffix(file.Name.Name, "_test")
+}
+
+// findModuleRoot returns the nearest folder containing a go.mod file, or an empty string.
+func findModuleRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readModulePath returns the module path declared in the go.mod file of the module root folder.
+func readModulePath(root string) string {
+	if modulePath, ok := modulePaths[root]; ok {
+		return modulePath
+	}
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	modulePath := ""
+	if err == nil {
+		modulePath = modfile.ModulePath(data)
+	}
+	modulePaths[root] = modulePath
+	return modulePath
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// baselineTestSource contains two structures which can be optimized and one optimal structure
+const baselineTestSource = `package models
+
+type Known struct {
+	a bool
+	b int64
+	c bool
+}
+
+type New struct {
+	a bool
+	b int32
+	c bool
+	d int64
+}
+
+type Optimal struct {
+	b int64
+	a bool
+}
+`
+
+// TestBaseline tests that findings recorded in a baseline are suppressed and stale entries are detected.
+func TestBaseline(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "models.go")
+	baselinePath := filepath.Join(dir, "baseline.json")
+	opts := fileProcessingOptions{out: io.Discard}
+
+	_, findings, err := processSource(path, []byte(baselineTestSource), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %d", len(findings))
+	}
+	// Record only "Known" and a finding for "Optimal", which doesn't exist anymore
+	stale := findings[0]
+	stale.structure = &Structure{Path: "Optimal", MetaData: &MetaData{}}
+	stale.signature = "a bool; b int64"
+	if err := writeBaseline(baselinePath, []finding{findings[0], stale}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.baseline, err = loadBaseline(baselinePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, findings, err = processSource(path, []byte(baselineTestSource), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].structure.Name != "New" {
+		t.Errorf("Expected only the new finding, got %+v", findings)
+	}
+	staleEntries := opts.baseline.stale()
+	if len(staleEntries) != 1 || staleEntries[0].Type != "Optimal" {
+		t.Errorf("Expected one stale entry for Optimal, got %+v", staleEntries)
+	}
+
+	// Entries of structures which are not selected or below thresholds are not stale
+	for name, tt := range map[string]struct {
+		opts  fileProcessingOptions
+		stale int
+	}{
+		"only changed": {fileProcessingOptions{out: io.Discard, onlyChanged: true}, 0},
+		"thresholds":   {fileProcessingOptions{out: io.Discard, thresholds: thresholds{minBytes: 64}}, 1},
+	} {
+		tt.opts.baseline, err = loadBaseline(baselinePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := processSource(path, []byte(baselineTestSource), tt.opts); err != nil {
+			t.Fatal(err)
+		}
+		if staleEntries := tt.opts.baseline.stale(); len(staleEntries) != tt.stale {
+			t.Errorf("%s: expected %d stale entries, got %+v", name, tt.stale, staleEntries)
+		}
+	}
+
+	// Fix mode leaves structures from the baseline untouched
+	opts.fixMode = true
+	result, _, err := processSource(path, []byte(baselineTestSource), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	structures, _, err := Parse(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signatures []string
+	for _, structure := range structures {
+		signatures = append(signatures, fieldSignature(structure))
+	}
+	expected := []string{"a bool; b int64; c bool", "d int64; b int32; a bool; c bool", "b int64; a bool"}
+	if !reflect.DeepEqual(signatures, expected) {
+		t.Errorf("Unexpected structures after fix: %v; want %v", signatures, expected)
+	}
+}
+
+// TestFieldSignature tests the description of structure fields used as a baseline key.
+func TestFieldSignature(t *testing.T) {
+	structures, _, err := ParseStrings(`package main
+
+type A struct {
+	time.Time
+	F1, F2 bool
+	F3     struct {
+		I int
+	}
+	F4 B
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "time.Time; F1 bool; F2 bool; F3 struct{I int}; F4 B"
+	if got := fieldSignature(structures[0]); got != expected {
+		t.Errorf("fieldSignature() = %q; want %q", got, expected)
+	}
+}
@@ -3,9 +3,12 @@ package main
 // calculateStructures calculates the size and alignment of structures in the given slice of Structure.
 // It recursively processes nested structures and updates their size and alignment information.
 func calculateStructure(elem *Structure, cache map[string]*Structure) {
-	var currentOffset, maxAlign uintptr
+	var currentOffset uintptr
+	maxAlign := uintptr(1)
+	elem.Unknown = false
 	for _, field := range elem.NestedFields {
 		var fieldSize, fieldAlign uintptr
+		var fieldUnknown bool
 
 		isValidCustomType := isValidCustomTypeName(field.StringType)
 
@@ -13,18 +16,22 @@ func calculateStructure(elem *Structure, cache map[string]*Structure) {
 			calculateStructure(field, cache)
 		}
 
-		if item, ok := cache[field.StringType]; ok {
+		if item, ok := cache[field.TypeID]; ok {
 			fieldSize = item.Size
 			fieldAlign = item.Align
+			fieldUnknown = item.Unknown
 		} else if item, ok = cache[elem.Path]; ok {
 			fieldSize = item.Size
 			fieldAlign = item.Align
+			fieldUnknown = item.Unknown
 		} else {
 			if field.IsStructure {
 				fieldSize, fieldAlign = calculateStructLayout(field)
+				fieldUnknown = field.Unknown
 			} else {
 				fieldSize = getFieldSize(field.StructType)
 				fieldAlign = getFieldAlign(field.StructType)
+				fieldUnknown = !isSizeKnown(field.StructType)
 			}
 		}
 
@@ -33,9 +40,13 @@ func calculateStructure(elem *Structure, cache map[string]*Structure) {
 		field.Size = fieldSize
 		field.Align = fieldAlign
 		field.Offset = currentOffset
+		field.Unknown = fieldUnknown
+		if fieldUnknown {
+			elem.Unknown = true
+		}
 
-		if isValidCustomType {
-			cache[field.StringType] = field
+		if isValidCustomType && field.TypeID != "" {
+			cache[field.TypeID] = field
 		} else {
 			cache[field.Path] = field
 		}
@@ -74,10 +85,42 @@ func calculateStructures(structures []*Structure, isBefore bool) {
 	cache := make(map[string]*Structure, len(structures))
 	for _, structure := range structures {
 		calculateStructure(structure, cache)
+		metaData := structure.MetaData
 		if isBefore {
-			structure.MetaData.BeforeSize = structure.Size
+			metaData.BeforeSize = structure.Size
 		} else {
-			structure.MetaData.AfterSize = structure.Size
+			metaData.AfterSize = structure.Size
+		}
+		switch {
+		case len(metaData.Instantiations) > 0:
+			calculateInstantiations(structure, isBefore)
+		case isBefore:
+			metaData.guesses.init(structure.NestedFields, declaredType)
+		default:
+			// Savings must not depend on guessed sizes
+			metaData.AfterSize = metaData.guesses.afterSize(metaData.BeforeSize, metaData.AfterSize, structure.NestedFields, declaredType)
+		}
+	}
+}
+
+// layoutFields returns the size and alignment of the fields in their current order, nested structures included.
+// leaf returns the size and alignment of a field which isn't a nested structure.
+func layoutFields(fields []*Structure, leaf func(field *Structure) (uintptr, uintptr)) (size, alignment uintptr) {
+	alignment = 1
+	for _, field := range fields {
+		fieldSize, fieldAlign := layoutField(field, leaf)
+		size = align(size, fieldAlign) + fieldSize
+		if fieldAlign > alignment {
+			alignment = fieldAlign
 		}
 	}
+	return align(size, alignment), alignment
+}
+
+// layoutField returns the size and alignment of the field, see layoutFields.
+func layoutField(field *Structure, leaf func(field *Structure) (uintptr, uintptr)) (size, alignment uintptr) {
+	if field.IsStructure {
+		return layoutFields(field.NestedFields, leaf)
+	}
+	return leaf(field)
 }
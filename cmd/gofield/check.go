@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// thresholds define which savings are meaningful enough to be reported.
+// Zero values accept any saving.
+type thresholds struct {
+	// minPercent is the minimal saving in percent of the structure size
+	minPercent float64
+	// minBytes is the minimal saving in bytes
+	minBytes uintptr
+	// minStructSize is the minimal size of structures to analyze, smaller ones are never reported
+	minStructSize uintptr
+}
+
+// isMeaningful checks if the saving of the structure reaches all thresholds.
+func (t thresholds) isMeaningful(structure *Structure) bool {
+	before := structure.MetaData.BeforeSize
+	after := structure.MetaData.AfterSize
+	if before <= after {
+		return false
+	}
+	saving := before - after
+	if before < t.minStructSize || saving < t.minBytes {
+		return false
+	}
+	return savingPercent(before, after) >= t.minPercent
+}
+
+// savingPercent returns the saving in percent of the size before optimization.
+func savingPercent(before, after uintptr) float64 {
+	if before == 0 || before <= after {
+		return 0
+	}
+	return float64(before-after) * 100 / float64(before)
+}
+
+// printCheckFindings prints findings in check mode, one line per structure.
+//
+//	path/file.go:12: User 24(b) -> 16(b), can free 8 bytes (33.3%)
+//	path/file.go:20: Hot 80(b) -> 72(b), can free 8 bytes (10.0%) [max size: 64(b) exceeded]
+//	path/file.go:30: Hot2 72(b) exceeds max size of 64(b)
+//	path/file.go:40: Event 48(b) -> 40(b), can free 8 bytes (16.7%) [partially analyzed, unknown sizes: time.Time]
+func printCheckFindings(w io.Writer, findings []finding) {
+	for _, item := range findings {
+		before := item.structure.MetaData.BeforeSize
+		after := item.structure.MetaData.AfterSize
+		if item.overBudget && !item.optimizable {
+			fmt.Fprintf(w, "%s:%d: %s %d(b) exceeds max size of %d(b)\n", item.path, item.line, item.structure.Path, before, item.structure.MetaData.MaxSize)
+			continue
+		}
+		fmt.Fprintf(
+			w,
+			"%s:%d: %s %d(b) -> %d(b), can free %d bytes (%.1f%%)%s%s\n",
+			item.path,
+			item.line,
+			item.structure.Path,
+			before,
+			after,
+			before-after,
+			savingPercent(before, after),
+			budgetString(item.structure, false),
+			partialString(item.structure),
+		)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestThresholds tests which savings are considered meaningful.
+func TestThresholds(t *testing.T) {
+	structure := func(before, after uintptr) *Structure {
+		return &Structure{MetaData: &MetaData{BeforeSize: before, AfterSize: after}}
+	}
+	tests := []struct {
+		name       string
+		thresholds thresholds
+		structure  *Structure
+		want       bool
+	}{
+		{"No thresholds", thresholds{}, structure(24, 16), true},
+		{"No saving", thresholds{}, structure(16, 16), false},
+		{"Enough bytes", thresholds{minBytes: 8}, structure(24, 16), true},
+		{"Not enough bytes", thresholds{minBytes: 9}, structure(24, 16), false},
+		{"Enough percent", thresholds{minPercent: 33}, structure(24, 16), true},
+		{"Not enough percent", thresholds{minPercent: 34}, structure(24, 16), false},
+		{"Big structure", thresholds{minStructSize: 24}, structure(24, 16), true},
+		{"Small structure", thresholds{minStructSize: 32}, structure(24, 16), false},
+		{"All thresholds", thresholds{minBytes: 8, minPercent: 10, minStructSize: 64}, structure(80, 56), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.thresholds.isMeaningful(tt.structure); got != tt.want {
+				t.Errorf("isMeaningful() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPrintCheckFindings tests the output format of the check mode.
+func TestPrintCheckFindings(t *testing.T) {
+	findings := []finding{
+		{
+			structure: &Structure{Name: "User", Path: "User", MetaData: &MetaData{BeforeSize: 24, AfterSize: 16}},
+			path:      "models/user.go",
+			line:      12,
+		},
+	}
+	var out bytes.Buffer
+	printCheckFindings(&out, findings)
+	expected := "models/user.go:12: User 24(b) -> 16(b), can free 8 bytes (33.3%)\n"
+	if out.String() != expected {
+		t.Errorf("printCheckFindings() = %q; want %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+)
+
+// commands are the subcommands of the program, called with the arguments following the command name.
+// Each command returns the exit code of the program.
+var commands = map[string]func(args []string) int{
+	"lock":    runLock,
+	"compare": runCompare,
+	"assert":  runAssert,
+	"verify":  runVerify,
+	"undo":    runUndo,
+}
+
+// discoveryFlags are the file discovery flags shared by the main command and subcommands
+type discoveryFlags struct {
+	files            *string
+	f                *string
+	ignore           *string
+	i                *string
+	pattern          *string
+	ignorePattern    *string
+	includeGenerated *bool
+	// defaultFiles are processed when no files have been given
+	defaultFiles string
+}
+
+// addDiscoveryFlags defines the file discovery flags in the flag set.
+// The default files are processed when neither --files nor -f is given.
+func addDiscoveryFlags(fs *flag.FlagSet, defaultFiles string) *discoveryFlags {
+	return &discoveryFlags{
+		files:            fs.String("files", "", "Comma-separated list of files, folders or Go package patterns to process"),
+		f:                fs.String("f", "", "Short form of --files"),
+		ignore:           fs.String("ignore", "", "Comma-separated list of files or folders to ignore"),
+		i:                fs.String("i", "", "Short form of --ignore"),
+		pattern:          fs.String("pattern", "", "Regex pattern for files to process"),
+		ignorePattern:    fs.String("ignore-pattern", "", "Regex pattern for files to ignore"),
+		includeGenerated: fs.Bool("include-generated", false, "Process generated files (// Code generated ... DO NOT EDIT.)"),
+		defaultFiles:     defaultFiles,
+	}
+}
+
+// addTypesFileFlag defines the --types-file flag in the flag set, see useTypesFile.
+func addTypesFileFlag(fs *flag.FlagSet) *string {
+	return fs.String("types-file", "", "JSON file with the sizes and alignments of types declared in other packages, cgo types or types excluded by build constraints")
+}
+
+// isEmpty checks if no files to process have been given.
+func (d *discoveryFlags) isEmpty() bool {
+	return *d.files == "" && *d.f == ""
+}
+
+// findFiles returns the sorted list of files selected by the flags.
+func (d *discoveryFlags) findFiles() ([]string, error) {
+	filePattern := *d.pattern
+	if filePattern == "" {
+		filePattern = defaultFilePattern
+	}
+	fileRegex, err := regexp.Compile(filePattern)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling file pattern regex: %w", err)
+	}
+	var ignoreRegex *regexp.Regexp
+	if *d.ignorePattern != "" {
+		ignoreRegex, err = regexp.Compile(*d.ignorePattern)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling ignore pattern regex: %w", err)
+		}
+	}
+
+	opts := discoveryOptions{
+		fileRegex:        fileRegex,
+		ignoreRegex:      ignoreRegex,
+		includeGenerated: *d.includeGenerated,
+	}
+	ignoresMap, err := findFiles(mergeFlags(*d.ignore, *d.i), opts, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find files to ignore: %w", err)
+	}
+	files := mergeFlags(*d.files, *d.f)
+	if len(files) == 0 {
+		files = splitAndTrim(d.defaultFiles)
+	}
+	filesToWork, err := findFiles(files, opts, ignoresMap)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find files to process: %w", err)
+	}
+
+	allFiles := make([]string, 0, len(filesToWork))
+	for filePath := range filesToWork {
+		allFiles = append(allFiles, filePath)
+	}
+	sort.Strings(allFiles)
+	return allFiles, nil
+}
+
+// newCommandFlagSet creates the flag set of a subcommand. Errors are returned by Parse instead of exiting.
+func newCommandFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet("gofield "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s\n\nOptions:\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseCommandFlags parses the arguments of a subcommand.
+// Returns false with the exit code when the command must not run.
+func parseCommandFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0, false
+	}
+	if err != nil {
+		return exitCodeErrors, false
+	}
+	return 0, true
+}
+
+// commandErrorf prints the error message of a subcommand and returns the tool error exit code.
+func commandErrorf(format string, v ...interface{}) int {
+	log.Printf(format, v...)
+	return exitCodeErrors
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Kinds of layout changes between two revisions
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeGrown   = "grown"
+	changeShrunk  = "shrunk"
+)
+
+// layoutChange describes how the size of a structure changed between two revisions
+type layoutChange struct {
+	Package string  `json:"package"`
+	Type    string  `json:"type"`
+	Change  string  `json:"change"`
+	OldSize uintptr `json:"old_size"`
+	NewSize uintptr `json:"new_size"`
+	Delta   int64   `json:"delta"`
+}
+
+// key returns the qualified name of the structure.
+func (c layoutChange) key() string {
+	return c.Package + "." + c.Type
+}
+
+// comparison is the result of the "compare" command
+type comparison struct {
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Changes []layoutChange `json:"changes"`
+}
+
+// revisionOptions define which files of a revision are analyzed
+type revisionOptions struct {
+	// pathspecs restrict the analyzed files, relative to the current folder
+	pathspecs        []string
+	fileRegex        *regexp.Regexp
+	ignoreRegex      *regexp.Regexp
+	includeGenerated bool
+}
+
+// compareLayouts returns the structures which have been added, removed, grown or shrunk, sorted by qualified name.
+func compareLayouts(from, to []structLayout) []layoutChange {
+	newLayouts := make(map[string]structLayout, len(to))
+	for _, layout := range to {
+		if _, ok := newLayouts[layout.key()]; !ok {
+			newLayouts[layout.key()] = layout
+		}
+	}
+	oldKeys := make(map[string]bool, len(from))
+	var changes []layoutChange
+	for _, oldLayout := range from {
+		if oldKeys[oldLayout.key()] {
+			// The same type declared in several files, e.g. with build constraints
+			continue
+		}
+		oldKeys[oldLayout.key()] = true
+		change := layoutChange{Package: oldLayout.Package, Type: oldLayout.Type, OldSize: oldLayout.Size}
+		newLayout, ok := newLayouts[oldLayout.key()]
+		switch {
+		case !ok:
+			change.Change = changeRemoved
+		case newLayout.Size > oldLayout.Size:
+			change.Change = changeGrown
+		case newLayout.Size < oldLayout.Size:
+			change.Change = changeShrunk
+		default:
+			continue
+		}
+		change.NewSize = newLayout.Size
+		change.Delta = int64(change.NewSize) - int64(change.OldSize)
+		changes = append(changes, change)
+	}
+	for key, newLayout := range newLayouts {
+		if !oldKeys[key] {
+			changes = append(changes, layoutChange{
+				Package: newLayout.Package,
+				Type:    newLayout.Type,
+				Change:  changeAdded,
+				NewSize: newLayout.Size,
+				Delta:   int64(newLayout.Size),
+			})
+		}
+	}
+	sortChanges(changes)
+	return changes
+}
+
+// sortChanges sorts changes by qualified name.
+func sortChanges(changes []layoutChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].key() < changes[j].key()
+	})
+}
+
+// revisionLayouts computes the layouts of the structures declared in a git revision,
+// reading files from the local repository without checking them out.
+func revisionLayouts(rev string, opts revisionOptions) ([]structLayout, error) {
+	allFiles, err := gitTreeFiles(rev, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	modules := make(map[string]string)
+	for _, file := range allFiles {
+		if path.Base(file) != "go.mod" {
+			continue
+		}
+		data, err := runGit("show", rev+":"+file)
+		if err != nil {
+			return nil, err
+		}
+		modules[path.Dir(file)] = modfile.ModulePath([]byte(data))
+	}
+
+	files, err := gitTreeFiles(rev, false, opts.pathspecs)
+	if err != nil {
+		return nil, err
+	}
+	// Types declared in other files of the packages are read from the revision as well
+	defer useRevisionFiles(rev, allFiles)()
+	var layouts []structLayout
+	for _, file := range files {
+		if !opts.matches(file) {
+			continue
+		}
+		data, err := runGit("show", rev+":"+file)
+		if err != nil {
+			return nil, err
+		}
+		fileData := []byte(data)
+		if !opts.includeGenerated && isGeneratedSource(file, fileData) {
+			continue
+		}
+		pkg := revisionPackage(modules, file)
+		if isExternalTestPackage(file, fileData) {
+			pkg += "_test"
+		}
+		items, err := fileLayouts(file, pkg, fileData)
+		if err != nil {
+			log.Printf("Skipping %s:%s: %v\n", rev, file, err)
+			continue
+		}
+		layouts = append(layouts, items...)
+	}
+	sortLayouts(layouts)
+	return layouts, nil
+}
+
+// useRevisionFiles makes the packages of analyzed files be read from the files of a git revision instead of
+// the working tree, see siblingFiles. The files are relative to the repository root, like the analyzed files.
+// Returns a function which restores reading from the working tree.
+func useRevisionFiles(rev string, files []string) func() {
+	folders := make(map[string][]string)
+	for _, file := range files {
+		if strings.HasSuffix(file, ".go") {
+			folders[path.Dir(file)] = append(folders[path.Dir(file)], file)
+		}
+	}
+	previousReader, previousPackages := readPackageFiles, siblingPackages
+	siblingPackages = map[string]*siblingPackage{}
+	readPackageFiles = func(dir string) (map[string][]byte, error) {
+		sources := make(map[string][]byte)
+		for _, file := range folders[filepath.ToSlash(dir)] {
+			data, err := runGit("show", rev+":"+file)
+			if err != nil {
+				return nil, err
+			}
+			sources[path.Base(file)] = []byte(data)
+		}
+		return sources, nil
+	}
+	return func() {
+		readPackageFiles, siblingPackages = previousReader, previousPackages
+	}
+}
+
+// matches checks if the file of a revision must be analyzed.
+func (o revisionOptions) matches(file string) bool {
+	for _, dir := range strings.Split(path.Dir(file), "/") {
+		if skippedDirs[dir] {
+			return false
+		}
+	}
+	if !o.fileRegex.MatchString(path.Base(file)) && !o.fileRegex.MatchString(file) {
+		return false
+	}
+	if o.ignoreRegex != nil && (o.ignoreRegex.MatchString(path.Base(file)) || o.ignoreRegex.MatchString(file)) {
+		return false
+	}
+	return true
+}
+
+// gitTreeFiles lists the files of a revision, relative to the repository root.
+// Unless fullTree is set, only files in the current folder (or matching the pathspecs) are listed.
+func gitTreeFiles(rev string, fullTree bool, pathspecs []string) ([]string, error) {
+	args := []string{"-c", "core.quotePath=false", "ls-tree", "-r", "-z", "--name-only", "--full-name"}
+	if fullTree {
+		args = append(args, "--full-tree")
+	}
+	args = append(args, rev, "--")
+	args = append(args, pathspecs...)
+	output, err := runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range strings.Split(output, "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// revisionPackage returns the import path of the package of a file in a revision,
+// using the module paths by module root folder. Files outside of modules are identified by their folder.
+func revisionPackage(modules map[string]string, file string) string {
+	fileDir := path.Dir(file)
+	for dir := fileDir; ; dir = path.Dir(dir) {
+		if modulePath := modules[dir]; modulePath != "" {
+			if dir == fileDir {
+				return modulePath
+			}
+			if dir == "." {
+				return modulePath + "/" + fileDir
+			}
+			return modulePath + "/" + strings.TrimPrefix(fileDir, dir+"/")
+		}
+		if dir == "." || dir == "/" {
+			return fileDir
+		}
+	}
+}
+
+// printComparison prints the changes grouped by kind, with byte deltas.
+func printComparison(w io.Writer, result comparison) {
+	fmt.Fprintf(w, "Comparing %s..%s\n", result.From, result.To)
+	if len(result.Changes) == 0 {
+		fmt.Fprintln(w, "No structure sizes changed")
+		return
+	}
+	var total int64
+	for _, kind := range []string{changeAdded, changeRemoved, changeGrown, changeShrunk} {
+		printed := false
+		for _, change := range result.Changes {
+			if change.Change != kind {
+				continue
+			}
+			if !printed {
+				fmt.Fprintf(w, "%s:\n", strings.ToUpper(kind[:1])+kind[1:])
+				printed = true
+			}
+			switch kind {
+			case changeAdded:
+				fmt.Fprintf(w, "%s+ %s %d(b)\n", strings.Repeat(" ", 3), change.key(), change.NewSize)
+			case changeRemoved:
+				fmt.Fprintf(w, "%s- %s %d(b)\n", strings.Repeat(" ", 3), change.key(), change.OldSize)
+			default:
+				fmt.Fprintf(w, "%s%s %d(b) -> %d(b) (%+d)\n", strings.Repeat(" ", 3), change.key(), change.OldSize, change.NewSize, change.Delta)
+			}
+		}
+	}
+	for _, change := range result.Changes {
+		total += change.Delta
+	}
+	fmt.Fprintf(w, "Total: %+d bytes\n", total)
+}
+
+// runCompare runs the "compare" command: prints how structure sizes changed between two git revisions.
+func runCompare(args []string) int {
+	fs := newCommandFlagSet("compare", "gofield compare [options] <rev1> <rev2> [paths...]")
+	format := fs.String("format", "text", "Output format: text or json")
+	typesFlag := fs.String("types", "", "Comma-separated list of structures to compare, by name or qualified name (default: all)")
+	patternFlag := fs.String("pattern", "", "Regex pattern for files to process")
+	ignorePatternFlag := fs.String("ignore-pattern", "", "Regex pattern for files to ignore")
+	includeGeneratedFlag := fs.Bool("include-generated", false, "Process generated files (// Code generated ... DO NOT EDIT.)")
+	typesFileFlag := addTypesFileFlag(fs)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if err := useTypesFile(*typesFileFlag); err != nil {
+		return commandErrorf("Cannot load types file: %v\n", err)
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return exitCodeErrors
+	}
+	if *format != "text" && *format != "json" {
+		return commandErrorf("Unknown format %q, expected text or json\n", *format)
+	}
+
+	filePattern := *patternFlag
+	if filePattern == "" {
+		filePattern = defaultFilePattern
+	}
+	pathspecs := fs.Args()[2:]
+	if len(pathspecs) > 0 && pathspecs[0] == "--" {
+		pathspecs = pathspecs[1:]
+	}
+	opts := revisionOptions{
+		pathspecs:        pathspecs,
+		includeGenerated: *includeGeneratedFlag,
+	}
+	var err error
+	if opts.fileRegex, err = regexp.Compile(filePattern); err != nil {
+		return commandErrorf("Error compiling file pattern regex: %v\n", err)
+	}
+	if *ignorePatternFlag != "" {
+		if opts.ignoreRegex, err = regexp.Compile(*ignorePatternFlag); err != nil {
+			return commandErrorf("Error compiling ignore pattern regex: %v\n", err)
+		}
+	}
+
+	result := comparison{From: fs.Arg(0), To: fs.Arg(1)}
+	from, err := revisionLayouts(result.From, opts)
+	if err != nil {
+		return commandErrorf("Cannot analyze revision %s: %v\n", result.From, err)
+	}
+	to, err := revisionLayouts(result.To, opts)
+	if err != nil {
+		return commandErrorf("Cannot analyze revision %s: %v\n", result.To, err)
+	}
+	types := splitAndTrim(*typesFlag)
+	result.Changes = compareLayouts(selectLayouts(from, types), selectLayouts(to, types))
+
+	if *format == "json" {
+		if result.Changes == nil {
+			result.Changes = []layoutChange{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return commandErrorf("Cannot encode comparison: %v\n", err)
+		}
+		return 0
+	}
+	printComparison(os.Stdout, result)
+	return 0
+}
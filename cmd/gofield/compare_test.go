@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// TestCompareLayouts tests the detection of added, removed, grown and shrunk structures.
+func TestCompareLayouts(t *testing.T) {
+	from := []structLayout{
+		{Package: "app", Type: "Grown", Size: 64},
+		{Package: "app", Type: "Removed", Size: 16},
+		{Package: "app", Type: "Same", Size: 8},
+		{Package: "app", Type: "Shrunk", Size: 24},
+	}
+	to := []structLayout{
+		{Package: "app", Type: "Added", Size: 32},
+		{Package: "app", Type: "Grown", Size: 72},
+		{Package: "app", Type: "Same", Size: 8},
+		{Package: "app", Type: "Shrunk", Size: 16},
+	}
+	expected := []layoutChange{
+		{Package: "app", Type: "Added", Change: changeAdded, NewSize: 32, Delta: 32},
+		{Package: "app", Type: "Grown", Change: changeGrown, OldSize: 64, NewSize: 72, Delta: 8},
+		{Package: "app", Type: "Removed", Change: changeRemoved, OldSize: 16, Delta: -16},
+		{Package: "app", Type: "Shrunk", Change: changeShrunk, OldSize: 24, NewSize: 16, Delta: -8},
+	}
+	changes := compareLayouts(from, to)
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("compareLayouts() = %+v; want %+v", changes, expected)
+	}
+
+	var out bytes.Buffer
+	printComparison(&out, comparison{From: "v1.0.0", To: "v1.1.0", Changes: changes})
+	expectedOutput := `Comparing v1.0.0..v1.1.0
+Added:
+   + app.Added 32(b)
+Removed:
+   - app.Removed 16(b)
+Grown:
+   app.Grown 64(b) -> 72(b) (+8)
+Shrunk:
+   app.Shrunk 24(b) -> 16(b) (-8)
+Total: +16 bytes
+`
+	if out.String() != expectedOutput {
+		t.Errorf("printComparison() = %q; want %q", out.String(), expectedOutput)
+	}
+}
+
+// TestRevisionPackage tests import paths of files read from a git revision.
+func TestRevisionPackage(t *testing.T) {
+	modules := map[string]string{
+		".":     "example.com/app",
+		"tools": "example.com/app/tools",
+	}
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"main.go", "example.com/app"},
+		{"internal/cache/entry.go", "example.com/app/internal/cache"},
+		{"tools/gen.go", "example.com/app/tools"},
+		{"tools/cmd/run/main.go", "example.com/app/tools/cmd/run"},
+	}
+	for _, tt := range tests {
+		if got := revisionPackage(modules, tt.file); got != tt.want {
+			t.Errorf("revisionPackage(%q) = %q; want %q", tt.file, got, tt.want)
+		}
+	}
+	if got := revisionPackage(nil, "pkg/a.go"); got != "pkg" {
+		t.Errorf("revisionPackage() outside of modules = %q; want %q", got, "pkg")
+	}
+}
+
+// TestRevisionLayoutsSiblingTypes tests that types declared in other files of a package are read from
+// the compared revisions, whichever revision is checked out.
+func TestRevisionLayoutsSiblingTypes(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/app\n\ngo 1.22\n")
+	write("a.go", "package app\n\ntype ID int8\n")
+	write("b.go", "package app\n\ntype S struct {\n\ta, b ID\n\tc    int32\n}\n")
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "v1")
+	git("tag", "v1")
+	write("a.go", "package app\n\ntype ID int64\n")
+	git("commit", "-q", "-a", "-m", "v2")
+	git("tag", "v2")
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workDir)
+	opts := revisionOptions{fileRegex: regexp.MustCompile(defaultFilePattern)}
+	expected := []layoutChange{
+		{Package: "example.com/app", Type: "S", Change: changeGrown, OldSize: 8, NewSize: 24, Delta: 16},
+	}
+	for _, checkout := range []string{"v1", "v2"} {
+		git("checkout", "-q", checkout)
+		from, err := revisionLayouts("v1", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		to, err := revisionLayouts("v2", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changes := compareLayouts(from, to); !reflect.DeepEqual(changes, expected) {
+			t.Errorf("compareLayouts() with %s checked out = %+v; want %+v", checkout, changes, expected)
+		}
+	}
+}
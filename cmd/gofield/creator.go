@@ -49,9 +49,11 @@ func createItemInfoPath(name, parentName string) string {
 // createTypeItemInfo creates a Structure from the given AST type node.
 // It processes its contents and creates nested structures as needed.
 // The function also updates the provided mapper with the created Structure.
-func createTypeItemInfo(typeSpec *ast.TypeSpec, parent *Structure, mapper map[string]*Structure) *Structure {
+// The scope is the scope the type is declared in, see scopes.
+func createTypeItemInfo(typeSpec *ast.TypeSpec, scope string, mapper map[string]*Structure) *Structure {
 	typeInfo := &Structure{
 		Name:        createTypeName(typeSpec),
+		Scope:       scope,
 		Root:        typeSpec,
 		StructType:  typeSpec.Type,
 		IsStructure: true,
@@ -61,7 +63,7 @@ func createTypeItemInfo(typeSpec *ast.TypeSpec, parent *Structure, mapper map[st
 		typeInfo.Name = "!" + typeInfo.StringType
 	}
 
-	typeInfo.Path = createItemInfoPath(typeInfo.Name, "")
+	typeInfo.Path = createItemInfoPath(qualifyName(scope, typeInfo.Name), "")
 	mapper[typeInfo.Path] = typeInfo
 
 	if structType, ok := typeSpec.Type.(*ast.StructType); ok {
@@ -76,6 +78,28 @@ func createTypeItemInfo(typeSpec *ast.TypeSpec, parent *Structure, mapper map[st
 	return typeInfo
 }
 
+// createStructItemInfo creates a Structure for an anonymous struct type declared outside of type declarations,
+// e.g. in "var cfg struct{...}". It processes its fields and updates the provided mapper.
+func createStructItemInfo(name, scope string, structType *ast.StructType, mapper map[string]*Structure) *Structure {
+	structInfo := &Structure{
+		Name:        name,
+		Scope:       scope,
+		StructType:  structType,
+		IsStructure: true,
+		StringType:  getTypeString(structType),
+	}
+	structInfo.Path = createItemInfoPath(qualifyName(scope, structInfo.Name), "")
+	mapper[structInfo.Path] = structInfo
+
+	for _, field := range structType.Fields.List {
+		newFields := createFieldItemsInfo(field, structInfo, mapper)
+		if len(newFields) > 0 {
+			structInfo.NestedFields = append(structInfo.NestedFields, newFields...)
+		}
+	}
+	return structInfo
+}
+
 // createFieldItemsInfo creates a list of Structure-s from the given AST field node.
 // The number of returned Structure-s is defined by how field node looks like.
 // It processes its contents and creates nested structures as needed.
@@ -99,6 +123,7 @@ func createSingleFieldItemInfo(name string, field *ast.Field, parent *Structure,
 		StructType: field.Type,
 		StringType: getTypeString(field.Type),
 	}
+	fieldInfo.TypeID = fieldInfo.StringType
 	if fieldInfo.Name == "" {
 		fieldInfo.Name = "!" + fieldInfo.StringType
 	}
@@ -106,10 +131,8 @@ func createSingleFieldItemInfo(name string, field *ast.Field, parent *Structure,
 	fieldInfo.Path = createItemInfoPath(fieldInfo.Name, parent.Path)
 	mapper[fieldInfo.Path] = fieldInfo
 
-	switch typed := field.Type.(type) {
-	case *ast.Ident:
-		fieldInfo.IsStructure = typed.Obj != nil
-	case *ast.StructType:
+	// Fields of named types are sized through their declarations, see typeSpecOf
+	if typed, ok := field.Type.(*ast.StructType); ok {
 		fieldInfo.IsStructure = true
 		for _, nestedField := range typed.Fields.List {
 			nestedFieldItems := createFieldItemsInfo(nestedField, fieldInfo, mapper)
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+// cacheLineSize is the size of a CPU cache line in bytes, used by "//gofield:maxsize cacheline"
+const cacheLineSize = 64
+
+// maxSizeDirective is the directive which defines the size budget of a structure
+const maxSizeDirective = "//gofield:maxsize"
+
+// parseMaxSizeDirective extracts the size budget from the doc comment of a type declaration.
+// Returns 0 when there is no budget.
+//
+//	//gofield:maxsize 64
+//	type Hot struct { ... }
+//
+//	//gofield:maxsize cacheline
+//	type Hot2 struct { ... }
+func parseMaxSizeDirective(doc *ast.CommentGroup) (uintptr, error) {
+	if doc == nil {
+		return 0, nil
+	}
+	for _, comment := range doc.List {
+		if !strings.HasPrefix(comment.Text, maxSizeDirective) {
+			continue
+		}
+		value := strings.TrimPrefix(comment.Text, maxSizeDirective)
+		if value != "" && value[0] != ' ' && value[0] != '\t' {
+			// Another directive, e.g. "//gofield:maxsizex"
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value == "cacheline" {
+			return cacheLineSize, nil
+		}
+		size, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || size == 0 {
+			return 0, fmt.Errorf("invalid %s directive %q: expected a positive number of bytes or \"cacheline\"", maxSizeDirective, value)
+		}
+		return uintptr(size), nil
+	}
+	return 0, nil
+}
+
+// typeSpecDoc returns the doc comment of a type spec. For declarations outside of "type (...)" blocks
+// the doc comment belongs to the declaration itself.
+func typeSpecDoc(genDecl *ast.GenDecl, typeSpec *ast.TypeSpec) *ast.CommentGroup {
+	if typeSpec.Doc != nil {
+		return typeSpec.Doc
+	}
+	if genDecl != nil && !genDecl.Lparen.IsValid() {
+		return genDecl.Doc
+	}
+	return nil
+}
+
+// isOverBudget checks if the size of the structure exceeds its budget.
+// After fixes are applied the optimized size is taken into account.
+func isOverBudget(structure *Structure, fixed bool) bool {
+	meta := structure.MetaData
+	if meta == nil || meta.MaxSize == 0 {
+		return false
+	}
+	size := meta.BeforeSize
+	if fixed {
+		size = meta.AfterSize
+	}
+	return size > meta.MaxSize
+}
+
+// budgetString describes the size budget of the structure for reports, or returns an empty string.
+func budgetString(structure *Structure, fixed bool) string {
+	meta := structure.MetaData
+	if meta == nil || meta.MaxSize == 0 {
+		return ""
+	}
+	if isOverBudget(structure, fixed) {
+		return fmt.Sprintf(" [max size: %d(b) exceeded]", meta.MaxSize)
+	}
+	return fmt.Sprintf(" [max size: %d(b)]", meta.MaxSize)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// budgetTestSource contains an optimal structure over its budget, a structure which fits its budget
+// only after optimization and a structure within its budget
+const budgetTestSource = `package models
+
+//gofield:maxsize 16
+type Optimal struct {
+	a int64
+	b int64
+	c int64
+}
+
+type (
+	// Fixable is 24 bytes before the fix and 16 bytes after it
+	//gofield:maxsize 16
+	Fixable struct {
+		a bool
+		b int64
+		c bool
+	}
+)
+
+//gofield:maxsize cacheline
+type Small struct {
+	a int64
+}
+`
+
+// TestParseMaxSizeDirective tests parsing of the size budget directive.
+func TestParseMaxSizeDirective(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    uintptr
+		wantErr bool
+	}{
+		{"No directive", "// Hot is a structure\ntype Hot struct{}", 0, false},
+		{"Bytes", "// Hot is a structure\n//gofield:maxsize 32\ntype Hot struct{}", 32, false},
+		{"Cache line", "//gofield:maxsize cacheline\ntype Hot struct{}", cacheLineSize, false},
+		{"Type block", "type (\n\t//gofield:maxsize 8\n\tHot struct{}\n)", 8, false},
+		{"Other directive", "//gofield:maxsizes 8\ntype Hot struct{}", 0, false},
+		{"Zero", "//gofield:maxsize 0\ntype Hot struct{}", 0, true},
+		{"Invalid", "//gofield:maxsize big\ntype Hot struct{}", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			structures, _, err := ParseStrings("package main\n\n" + tt.source + "\n")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v; wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := structures[0].MetaData.MaxSize; got != tt.want {
+				t.Errorf("MaxSize = %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSizeBudget tests that structures exceeding their budget are reported, also when they are optimal.
+func TestSizeBudget(t *testing.T) {
+	var out bytes.Buffer
+	opts := fileProcessingOptions{out: &out, viewMode: true}
+	_, findings, err := processSource("models.go", []byte(budgetTestSource), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %+v", findings)
+	}
+	if item := findings[0]; item.structure.Name != "Optimal" || item.optimizable || !item.overBudget {
+		t.Errorf("Unexpected finding for Optimal: %+v", item)
+	}
+	if item := findings[1]; item.structure.Name != "Fixable" || !item.optimizable || !item.overBudget {
+		t.Errorf("Unexpected finding for Fixable: %+v", item)
+	}
+	for _, expected := range []string{
+		"Optimal         24(b) exceeds max size of 16(b)!",
+		"Fixable         24(b) -> 16(b) can free 8 bytes! [max size: 16(b) exceeded]",
+		"Small           ✓ [max size: 64(b)]",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, out.String())
+		}
+	}
+
+	var check bytes.Buffer
+	printCheckFindings(&check, findings)
+	expected := "models.go:4: Optimal 24(b) exceeds max size of 16(b)\n" +
+		"models.go:13: Fixable 24(b) -> 16(b), can free 8 bytes (33.3%) [max size: 16(b) exceeded]\n"
+	if check.String() != expected {
+		t.Errorf("printCheckFindings() = %q; want %q", check.String(), expected)
+	}
+
+	// After the fix only the optimal structure is still over budget
+	opts = fileProcessingOptions{out: io.Discard, fixMode: true}
+	result, findings, err := processSource("models.go", []byte(budgetTestSource), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result == nil {
+		t.Fatal("Expected Fixable to be fixed")
+	}
+	overBudget := overBudgetFindings(findings)
+	if len(overBudget) != 1 || overBudget[0].structure.Name != "Optimal" {
+		t.Errorf("Expected only Optimal to exceed its budget, got %+v", overBudget)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// skippedDirs are folders which are never descended into while walking folders
+var skippedDirs = map[string]bool{
+	".git":         true,
+	".gofield":     true, // backups of --fix runs
+	"vendor":       true,
+	"node_modules": true,
+	"testdata":     true,
+}
+
+// discoveryOptions is a set of options which define how files are discovered.
+type discoveryOptions struct {
+	fileRegex        *regexp.Regexp
+	ignoreRegex      *regexp.Regexp
+	includeGenerated bool
+}
+
+// fileFinder discovers files to process.
+//
+// It skips vendor, node_modules, .git and testdata folders, honors .gitignore and .gofieldignore files,
+// follows symlinked folders without visiting the same folder twice and skips generated files.
+type fileFinder struct {
+	opts        discoveryOptions
+	ignoreFiles map[string]interface{}
+	ignores     *ignoreMatcher
+	visitedDirs map[string]struct{}
+	workDir     string
+	found       map[string]interface{}
+}
+
+// findFiles searches for files matching the given regex patterns and ignoring specified files.
+//
+// Besides files and folders, Go package patterns (./..., ./internal/...) and import paths are accepted.
+func findFiles(files []string, opts discoveryOptions, ignoreFiles map[string]interface{}) (map[string]interface{}, error) {
+	workDir, _ := os.Getwd()
+	finder := &fileFinder{
+		opts:        opts,
+		ignoreFiles: ignoreFiles,
+		ignores:     newIgnoreMatcher(),
+		visitedDirs: make(map[string]struct{}),
+		workDir:     workDir,
+		found:       make(map[string]interface{}),
+	}
+
+	for _, file := range files {
+		if isPackagePattern(file) {
+			pkgFiles, err := findPackageFiles(file)
+			if err != nil {
+				return nil, fmt.Errorf("error processing pattern %s: %v", file, err)
+			}
+			finder.addPackageFiles(pkgFiles)
+			continue
+		}
+		absPath, _ := filepath.Abs(file)
+		info, err := os.Stat(absPath)
+		if os.IsNotExist(err) {
+			// Not a file or folder - try to resolve it as an import path
+			pkgFiles, pkgErr := findPackageFiles(file)
+			if pkgErr != nil || len(pkgFiles) == 0 {
+				return nil, fmt.Errorf("path does not exist: %s", absPath)
+			}
+			finder.addPackageFiles(pkgFiles)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error processing path %s: %v", absPath, err)
+		}
+		if !info.IsDir() {
+			// Explicitly listed files are not checked against ignore files
+			finder.addFile(absPath)
+			continue
+		}
+		if err := finder.walk(findIgnoreRoot(absPath), absPath); err != nil {
+			return nil, fmt.Errorf("error processing path %s: %v", absPath, err)
+		}
+	}
+	return finder.found, nil
+}
+
+// walk recursively finds files in the given folder.
+// root is the folder whose ignore files apply to the walked folder.
+func (f *fileFinder) walk(root, dir string) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("error accessing %s: %v", dir, err)
+	}
+	if _, ok := f.visitedDirs[realDir]; ok {
+		return nil
+	}
+	f.visitedDirs[realDir] = struct{}{}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsPermission(err) {
+			fmt.Printf("Warning: Permission denied accessing %s\n", dir)
+			return nil
+		}
+		return fmt.Errorf("error accessing %s: %v", dir, err)
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			info, err := os.Stat(path)
+			if err != nil {
+				// Broken symlink
+				continue
+			}
+			isDir = info.IsDir()
+		}
+
+		if isDir {
+			if skippedDirs[entry.Name()] || f.ignores.isIgnored(root, path, true) {
+				continue
+			}
+			if err := f.walk(root, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.ignores.isIgnored(root, path, false) {
+			continue
+		}
+		f.addFile(path)
+	}
+	return nil
+}
+
+// addPackageFiles adds the files resolved from a Go package pattern, honoring ignore files.
+func (f *fileFinder) addPackageFiles(files []string) {
+	for _, file := range files {
+		if f.ignores.isIgnored(findIgnoreRoot(filepath.Dir(file)), file, false) {
+			continue
+		}
+		f.addFile(file)
+	}
+}
+
+// addFile adds the file if it matches the file patterns, is not ignored and is not generated.
+//
+// Patterns are matched against both the base name and the path relative to the working folder,
+// so "^internal/" and "_test\.go$" are both valid patterns.
+func (f *fileFinder) addFile(file string) {
+	if _, ok := f.ignoreFiles[file]; ok {
+		return
+	}
+	if !f.matchPattern(f.opts.fileRegex, file) {
+		return
+	}
+	if f.opts.ignoreRegex != nil && f.matchPattern(f.opts.ignoreRegex, file) {
+		return
+	}
+	if !f.opts.includeGenerated && isGeneratedFile(file) {
+		return
+	}
+	f.found[file] = struct{}{}
+}
+
+// matchPattern checks if the regex matches the base name of the file or, for files inside
+// the working folder, its slash-separated relative path.
+func (f *fileFinder) matchPattern(regex *regexp.Regexp, file string) bool {
+	if regex.MatchString(filepath.Base(file)) {
+		return true
+	}
+	rel, err := filepath.Rel(f.workDir, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return regex.MatchString(filepath.ToSlash(rel))
+}
+
+// isGeneratedFile checks if the file starts with a "// Code generated ... DO NOT EDIT." comment.
+func isGeneratedFile(path string) bool {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return isGeneratedSource(path, src)
+}
+
+// isGeneratedSource checks if the Go source starts with a "// Code generated ... DO NOT EDIT." comment.
+func isGeneratedSource(path string, src []byte) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), path, src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return false
+	}
+	return ast.IsGenerated(file)
+}
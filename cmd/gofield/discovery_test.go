@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestParseIgnoreRules tests parsing of .gitignore-style rules.
+func TestParseIgnoreRules(t *testing.T) {
+	data := []byte("# comment\n\n*.pb.go\n/generated/\ninternal/**/mock_*.go\n!keep.pb.go\n\\#hash.go\r\n")
+	expected := []ignoreRule{
+		{pattern: "**/*.pb.go"},
+		{pattern: "generated", dirOnly: true},
+		{pattern: "internal/**/mock_*.go"},
+		{pattern: "**/keep.pb.go", negate: true},
+		{pattern: "**/#hash.go"},
+	}
+	rules := parseIgnoreRules(data)
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("parseIgnoreRules() = %+v; want %+v", rules, expected)
+	}
+}
+
+// TestFindFilesDiscovery tests that folder walking honors ignore files, skipped folders and generated files.
+func TestFindFilesDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":                       "package main",
+		"api.pb.go":                     "package main",
+		"keep.pb.go":                    "package main",
+		"gen.go":                        "// Code generated by tool. DO NOT EDIT.\n\npackage main",
+		"vendor/lib/lib.go":             "package lib",
+		"testdata/data.go":              "package data",
+		"node_modules/x/x.go":           "package x",
+		"generated/models.go":           "package generated",
+		"internal/a/mock_service.go":    "package a",
+		"internal/a/service.go":         "package a",
+		"internal/b/ignored_by_git.go":  "package b",
+		"internal/b/.gitignore":         "ignored_by_git.go\n",
+		".gofieldignore":                "*.pb.go\n!keep.pb.go\n/generated/\ninternal/**/mock_*.go\n",
+		"internal/b/nested/nested.go":   "package nested",
+		"internal/b/nested/.gitignore":  "# nothing\n",
+		"internal/c/generated/keep.go":  "package generated",
+		"internal/c/generated/.keep.go": "package generated",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		// Symlink loop must not hang the walker
+		if err := os.Symlink(dir, filepath.Join(dir, "internal", "loop")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := discoveryOptions{fileRegex: regexp.MustCompile(defaultFilePattern)}
+	found, err := findFiles([]string{dir}, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"internal/a/service.go",
+		"internal/b/nested/nested.go",
+		"internal/c/generated/.keep.go",
+		"internal/c/generated/keep.go",
+		"keep.pb.go",
+		"main.go",
+	}
+	if got := relativeFiles(t, dir, found); !reflect.DeepEqual(got, expected) {
+		t.Errorf("findFiles() = %v; want %v", got, expected)
+	}
+
+	opts.includeGenerated = true
+	found, err = findFiles([]string{dir}, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := found[filepath.Join(dir, "gen.go")]; !ok {
+		t.Errorf("Expected generated file with includeGenerated, got: %v", relativeFiles(t, dir, found))
+	}
+
+	// Patterns are matched against relative paths as well as base names
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workDir)
+	opts = discoveryOptions{fileRegex: regexp.MustCompile(`^internal/.*\.go$`)}
+	found, err = findFiles([]string{"."}, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := relativeFiles(t, dir, found); len(got) != 4 {
+		t.Errorf("Expected 4 files under internal/, got: %v", got)
+	}
+}
+
+// relativeFiles returns sorted slash-separated paths of the found files relative to dir.
+func relativeFiles(t *testing.T, dir string, found map[string]interface{}) []string {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for file := range found {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel, _ = filepath.Rel(realDir, file)
+		}
+		result = append(result, filepath.ToSlash(rel))
+	}
+	sort.Strings(result)
+	return result
+}
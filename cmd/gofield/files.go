@@ -2,11 +2,11 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/format"
+	"io"
 	"os"
-	"path/filepath"
-	"regexp"
 	"strings"
 )
 
@@ -31,64 +31,82 @@ func splitAndTrim(s string) []string {
 	return result
 }
 
-// findFiles searches for files matching the given regex patterns and ignoring specified files.
-func findFiles(files []string, fileRegex, ignoreRegex *regexp.Regexp, ignoreFiles map[string]interface{}) (map[string]interface{}, error) {
-	filesMap := make(map[string]interface{})
-
-	for _, file := range files {
-		absPath, _ := filepath.Abs(file)
-		if _, err := os.Stat(absPath); os.IsNotExist(err) {
-			return nil, fmt.Errorf("path does not exist: %s", absPath)
-		}
-		if err := findMatchingFiles(absPath, fileRegex, ignoreRegex, filesMap, ignoreFiles); err != nil {
-			return nil, fmt.Errorf("error processing path %s: %v", absPath, err)
-		}
-	}
-	return filesMap, nil
-}
-
-// findMatchingFiles walks through the directory structure and finds files matching the given patterns.
-func findMatchingFiles(path string, fileRegex, ignoreRegex *regexp.Regexp, oldFiles, ignoreFiles map[string]interface{}) error {
-	return filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
-		if err != nil {
-			if os.IsPermission(err) {
-				fmt.Printf("Warning: Permission denied accessing %s\n", file)
-				return nil
-			}
-			return fmt.Errorf("error accessing %s: %v", file, err)
-		}
-
-		if !info.IsDir() {
-			basename := filepath.Base(file)
-			if _, ok := ignoreFiles[file]; !ok {
-				if fileRegex.MatchString(basename) && (ignoreRegex == nil || !ignoreRegex.MatchString(basename)) && oldFiles != nil {
-					oldFiles[file] = struct{}{}
-				}
-			}
-		}
-
-		return nil
-	})
-}
-
 // fileProcessingOptions is a set of options which define how file gets processed.
 type fileProcessingOptions struct {
-	viewMode  bool
-	fixMode   bool
-	debugMode bool
+	// out is where the report is printed
+	out io.Writer
+	// changes are the changed lines of the file, used when onlyChanged is set
+	changes     *fileChanges
+	viewMode    bool
+	fixMode     bool
+	debugMode   bool
+	onlyChanged bool
+	// scopedFormat formats only the rewritten structures instead of the whole file
+	scopedFormat bool
+	// thresholds define which savings are reported
+	thresholds thresholds
+	// baseline contains known findings which are neither reported nor fixed
+	baseline *baseline
+}
+
+// finding describes a structure which can be optimized or exceeds its size budget
+type finding struct {
+	structure *Structure
+	// path is the path of the file the structure is declared in
+	path string
+	// line is the line the structure is declared at
+	line int
+	// pkg is the import path of the package the structure belongs to
+	pkg string
+	// signature describes the fields of the structure in their original order
+	signature string
+	// optimizable is set when the structure can be optimized
+	optimizable bool
+	// overBudget is set when the structure exceeds its "//gofield:maxsize" budget
+	overBudget bool
 }
 
 // processFile processes a file located at the specified path.
 //
-// Returns true if the file can be optimized (needs fix), false otherwise.
-func processFile(path string, opts fileProcessingOptions) (needFix bool, err error) {
+// In fix mode, returns the optimized source (nil when nothing has been fixed). The file itself is not written,
+// see writeRewrites. Returns the structures which can be optimized (need fix) or exceed their size budget.
+func processFile(path string, opts fileProcessingOptions) ([]byte, []finding, error) {
+	if opts.onlyChanged && opts.changes != nil && opts.changes.unstaged {
+		// Line ranges of the index are matched against the staged content, which cannot be fixed in place
+		if opts.fixMode {
+			return nil, nil, errors.New("file has both staged and unstaged changes, stage or stash them before using --staged --fix")
+		}
+		fileData, err := opts.changes.stagedContent()
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read staged file: %w", err)
+		}
+		return processSource(path, fileData, opts)
+	}
 	fileData, err := os.ReadFile(path)
 	if err != nil {
-		return false, fmt.Errorf("cannot read file: %w", err)
+		return nil, nil, fmt.Errorf("cannot read file: %w", err)
 	}
-	structures, mapStructures, err := Parse(fileData)
+	return processSource(path, fileData, opts)
+}
+
+// processSource analyzes the Go source of a file, prints the report for it and,
+// in fix mode, returns the optimized source (nil when nothing has been fixed).
+//
+// The path is only used in the report and diagnostics. Returns the structures which can be optimized (need fix)
+// or exceed their size budget.
+// Structures recorded in the baseline or with savings below thresholds are neither reported nor fixed.
+func processSource(path string, fileData []byte, opts fileProcessingOptions) (result []byte, findings []finding, err error) {
+	out := opts.out
+	if out == nil {
+		out = os.Stdout
+	}
+	// The BOM and line endings are restored in the result, offsets are computed without the BOM
+	style := detectTextStyle(fileData)
+	fileData = bytes.TrimPrefix(fileData, utf8BOM)
+
+	structures, mapStructures, err := parseData(path, fileData)
 	if err != nil {
-		return false, fmt.Errorf("cannot parse file: %w", err)
+		return nil, nil, fmt.Errorf("cannot parse file: %w", err)
 	}
 
 	calculateStructures(structures, true)
@@ -103,79 +121,196 @@ func processFile(path string, opts fileProcessingOptions) (needFix bool, err err
 	optimizeMapperStructures(mapStructures)
 	calculateStructures(structures, false)
 
+	allStructures := structures
+	if opts.onlyChanged {
+		// Every structure is calculated above, since sizes of changed structures may depend on other ones
+		structures = selectChangedStructures(normalizeLineEndings(fileData), structures, opts.changes)
+	}
+
+	pkg := packageImportPath(path, fileData)
+	var fixStructures []*Structure
+	found := make(map[*Structure]finding)
+	baselined := make(map[*Structure]bool)
+	belowThresholds := make(map[*Structure]bool)
 	for _, structure := range structures {
-		if structure.MetaData.BeforeSize > structure.MetaData.AfterSize {
-			needFix = true
-			break
+		optimizable := structure.MetaData.BeforeSize > structure.MetaData.AfterSize
+		if optimizable && !opts.thresholds.isMeaningful(structure) {
+			belowThresholds[structure] = true
+			optimizable = false
 		}
+		overBudget := isOverBudget(structure, opts.fixMode && optimizable)
+		if opts.baseline != nil && (!belowThresholds[structure] || overBudget) {
+			opts.baseline.addStructure(pkg, structure.Path)
+		}
+		if !optimizable && !overBudget {
+			continue
+		}
+		item := finding{
+			structure:   structure,
+			path:        path,
+			line:        offsetLine(normalizeLineEndings(fileData), structure.MetaData.StartPos-1),
+			pkg:         pkg,
+			signature:   fieldSignature(oldStructuresMapper[structure.Path]),
+			optimizable: optimizable,
+			overBudget:  overBudget,
+		}
+		if opts.baseline != nil && opts.baseline.contains(item) {
+			baselined[structure] = true
+			continue
+		}
+		found[structure] = item
+		findings = append(findings, item)
+		if optimizable {
+			fixStructures = append(fixStructures, structure)
+		}
+	}
+	fixStructures = fixIdenticalTogether(allStructures, fixStructures)
+	fixed := make(map[*Structure]bool, len(fixStructures))
+	for _, structure := range fixStructures {
+		fixed[structure] = true
 	}
-	if opts.viewMode || needFix {
-		fmt.Printf("%s\n", path)
+
+	if opts.viewMode || len(findings) > 0 {
+		fmt.Fprintf(out, "%s\n", path)
 	}
 	for idx, structure := range structures {
-		if structure.MetaData.BeforeSize > structure.MetaData.AfterSize {
-			alert := fmt.Sprintf("can free %d bytes", structure.MetaData.BeforeSize-structure.MetaData.AfterSize)
-			if opts.fixMode {
-				alert = "Fixed"
+		if item, ok := found[structure]; ok {
+			if item.optimizable {
+				alert := fmt.Sprintf("can free %d bytes", structure.MetaData.BeforeSize-structure.MetaData.AfterSize)
+				if opts.fixMode && fixed[structure] {
+					alert = "Fixed"
+				}
+				fmt.Fprintf(
+					out,
+					"%s%-15s %d(b) -> %d(b) %s!%s%s\n",
+					strings.Repeat(" ", 3),
+					structure.Path,
+					structure.MetaData.BeforeSize,
+					structure.MetaData.AfterSize,
+					alert,
+					budgetString(structure, opts.fixMode),
+					partialString(structure),
+				)
+			} else {
+				fmt.Fprintf(
+					out,
+					"%s%-15s %d(b) exceeds max size of %d(b)!%s\n",
+					strings.Repeat(" ", 3),
+					structure.Path,
+					structure.MetaData.BeforeSize,
+					structure.MetaData.MaxSize,
+					partialString(structure),
+				)
 			}
-			fmt.Printf(
-				"%s%-15s %d(b) -> %d(b) %s!\n",
-				strings.Repeat(" ", 3),
-				structure.Name,
-				structure.MetaData.BeforeSize,
-				structure.MetaData.AfterSize,
-				alert,
-			)
+			fprintInstantiations(out, structure)
 			if opts.debugMode {
 				oldStructure, ok := oldStructuresMapper[structure.Path]
 				if ok {
-					fmt.Printf("%s%-20s\n", strings.Repeat(" ", 9), "------------------------------------------ [BEFORE]")
-					testPrintStructure(oldStructure, 9)
-					fmt.Printf("%s%-20s\n", strings.Repeat(" ", 9), "------------------------------------------ [AFTER]")
-					testPrintStructure(structure, 9)
+					fmt.Fprintf(out, "%s%-20s\n", strings.Repeat(" ", 9), "------------------------------------------ [BEFORE]")
+					fprintStructure(out, oldStructure, 9)
+					fmt.Fprintf(out, "%s%-20s\n", strings.Repeat(" ", 9), "------------------------------------------ [AFTER]")
+					fprintStructure(out, structure, 9)
 				}
 			}
 			if idx != len(structures)-1 && opts.debugMode {
-				fmt.Println()
+				fmt.Fprintln(out)
 			}
-		} else {
-			if opts.viewMode {
-				fmt.Printf("%s%-15s ✓\n", strings.Repeat(" ", 3), structure.Name)
+		} else if opts.viewMode {
+			switch {
+			case baselined[structure]:
+				fmt.Fprintf(out, "%s%-15s %d(b) -> %d(b) in baseline%s%s\n", strings.Repeat(" ", 3), structure.Path, structure.MetaData.BeforeSize, structure.MetaData.AfterSize, budgetString(structure, false), partialString(structure))
+			case belowThresholds[structure]:
+				fmt.Fprintf(out, "%s%-15s %d(b) -> %d(b) below thresholds%s%s\n", strings.Repeat(" ", 3), structure.Path, structure.MetaData.BeforeSize, structure.MetaData.AfterSize, budgetString(structure, false), partialString(structure))
+			default:
+				fmt.Fprintf(out, "%s%-15s ✓%s%s\n", strings.Repeat(" ", 3), structure.Path, budgetString(structure, false), partialString(structure))
 			}
+			fprintInstantiations(out, structure)
 		}
 	}
 	if opts.viewMode && len(structures) > 0 {
-		fmt.Println()
+		fmt.Fprintln(out)
 	}
 
-	if !opts.fixMode || !needFix {
+	if !opts.fixMode || len(fixStructures) == 0 {
 		// If "fix" has not been requested or there's nothing to fix, exit
-		return needFix, nil
+		return nil, findings, nil
 	}
 
 	// FIX
-	renderTextStructures(structures)
+	if opts.scopedFormat {
+		if err := renderTextStructures(fileData, fixStructures); err != nil {
+			return nil, findings, fmt.Errorf("cannot reorder fields: %w", err)
+		}
+		resultData, err := scopedReplace(path, fileData, fixStructures, style)
+		if err != nil {
+			return nil, findings, fmt.Errorf("cannot replace content in file: %w", err)
+		}
+		if err := checkFieldTypes(fileData, resultData); err != nil {
+			return nil, findings, fmt.Errorf("refusing to write: %w", err)
+		}
+		if style.bom {
+			resultData = append(append([]byte{}, utf8BOM...), resultData...)
+		}
+		return resultData, findings, nil
+	}
 
-	// Apply replacements
-	resultData, err := Replacer(fileData, structures)
+	// Reorder fields in the syntax tree and print the whole file
+	resultData, err := Rewriter(fileData, fixStructures)
 	if err != nil {
-		return needFix, fmt.Errorf("cannot replace content in file: %w", err)
+		return nil, findings, fmt.Errorf("cannot reorder fields: %w", err)
 	}
 
-	// Format results.
-	//
-	// They need to be formatted after all replacements have been applied
+	// Format results the same way as gofmt, e.g. sort imports
 	formatted, err := format.Source(resultData)
 	if err != nil {
-		return needFix, fmt.Errorf("cannot format result content: %w", err)
+		return nil, findings, fmt.Errorf("cannot format result content: %w", err)
+	}
+	if err := checkFieldTypes(fileData, formatted); err != nil {
+		return nil, findings, fmt.Errorf("refusing to write: %w", err)
 	}
+	return style.restore(formatted), findings, nil
+}
 
-	// Write results
-	err = os.WriteFile(path, formatted, 0644)
-	if err != nil {
-		return needFix, fmt.Errorf("cannot write results to file: %w", err)
+// selectChangedStructures returns the top-level structures which overlap with changed lines.
+func selectChangedStructures(fileData []byte, structures []*Structure, changes *fileChanges) []*Structure {
+	var selected []*Structure
+	for _, structure := range structures {
+		if changes.overlaps(structureLines(fileData, structure)) {
+			selected = append(selected, structure)
+		}
+	}
+	return selected
+}
+
+// utf8BOM is the UTF-8 byte order mark
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// textStyle describes details of a source file which must survive rewriting
+type textStyle struct {
+	bom  bool
+	crlf bool
+}
+
+// detectTextStyle detects the UTF-8 BOM and the line endings of the data.
+// Files with mixed line endings get the line endings of the majority of their lines.
+func detectTextStyle(data []byte) textStyle {
+	crlf := bytes.Count(data, []byte("\r\n"))
+	lf := bytes.Count(data, []byte("\n")) - crlf
+	return textStyle{
+		bom:  bytes.HasPrefix(data, utf8BOM),
+		crlf: crlf > lf,
+	}
+}
+
+// restore applies the style to data with LF line endings and without BOM.
+func (s textStyle) restore(data []byte) []byte {
+	if s.crlf {
+		data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	}
+	if s.bom {
+		data = append(append([]byte{}, utf8BOM...), data...)
 	}
-	return needFix, nil
+	return data
 }
 
 // normalizeLineEndings converts all line endings to LF
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -39,6 +40,8 @@ func TestGoPadding(t *testing.T) {
 		t.Run("SymbolicLinks", func(t *testing.T) { testSymbolicLinks(t, tempDir) })
 	}
 	t.Run("AccessRights", func(t *testing.T) { testAccessRights(t, tempDir) })
+	t.Run("KeepGoing", func(t *testing.T) { testKeepGoing(t) })
+	t.Run("PackagePatterns", func(t *testing.T) { testPackagePatterns(t) })
 }
 
 // createTestFiles creates a set of test files in the specified directory.
@@ -347,6 +350,67 @@ func testAccessRights(t *testing.T, dir string) {
 	}
 }
 
+// testKeepGoing tests that gofield continues after a file fails to parse when --keep-going is set.
+func testKeepGoing(t *testing.T) {
+	dir := t.TempDir()
+	brokenFile := filepath.Join(dir, "a_broken.go")
+	err := os.WriteFile(brokenFile, []byte("package main\n\ntype Broken struct {"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create broken file: %v", err)
+	}
+	unalignedFile := filepath.Join(dir, "b_unaligned.go")
+	err = os.WriteFile(unalignedFile, []byte("package main\n\ntype Unaligned struct {\n\ta bool\n\tb int64\n\tc bool\n}\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create unaligned file: %v", err)
+	}
+
+	output, err := runCommand("--files", dir)
+	if err == nil {
+		t.Errorf("Expected error without --keep-going, got none. Output: %s", output)
+	}
+	if strings.Contains(output, "Unaligned") {
+		t.Errorf("Expected processing to stop at the broken file, got: %s", output)
+	}
+	if !strings.Contains(output, "exit status 2") {
+		t.Errorf("Expected exit status 2 without --keep-going, got: %s", output)
+	}
+
+	output, err = runCommand("--files", dir, "--keep-going")
+	if err == nil {
+		t.Errorf("Expected error with --keep-going, got none. Output: %s", output)
+	}
+	if !strings.Contains(output, "Unaligned") {
+		t.Errorf("Expected findings for the remaining files, got: %s", output)
+	}
+	if !strings.Contains(output, "Failed to process 1 files") || !strings.Contains(output, brokenFile) {
+		t.Errorf("Expected summary of failed files, got: %s", output)
+	}
+	if !strings.Contains(output, "exit status 2") {
+		t.Errorf("Expected exit status 2 with --keep-going, got: %s", output)
+	}
+}
+
+// testPackagePatterns tests that --files accepts Go package patterns and import paths.
+func testPackagePatterns(t *testing.T) {
+	output, _ := runCommand("--files", "../../example/...")
+	if !strings.Contains(output, "Files analyzed: 7") {
+		t.Errorf("Unexpected output for package pattern: %s", output)
+	}
+
+	output, err := runCommand("--files", "github.com/t34-dev/go-field-alignment/v2/example/ignore", "--view")
+	if err != nil {
+		t.Errorf("Import path failed: %v", err)
+	}
+	if !strings.Contains(output, "Files analyzed: 3") || !strings.Contains(output, "userx_test.go") {
+		t.Errorf("Unexpected output for import path: %s", output)
+	}
+
+	output, _ = runCommand("--files", "../../example/...", "--ignore-pattern", "_test\\.go$")
+	if !strings.Contains(output, "Files analyzed: 5") {
+		t.Errorf("Unexpected output for package pattern with ignore pattern: %s", output)
+	}
+}
+
 // countGoFiles counts the number of Go files in a directory.
 func countGoFiles(t *testing.T, dir string) int {
 	count := 0
@@ -474,3 +538,35 @@ func TestSplitAndTrim(t *testing.T) {
 		})
 	}
 }
+
+// TestPreserveTextStyle tests that the BOM and line endings of a file survive fixes.
+func TestPreserveTextStyle(t *testing.T) {
+	source := "package models\n\n// A can be optimized\ntype A struct {\n\ta bool\n\tb int64\n\tc bool\n}\n"
+	expected := "package models\n\n// A can be optimized\ntype A struct {\n\tb int64\n\ta bool\n\tc bool\n}\n"
+	bom := string(utf8BOM)
+	crlf := func(s string) string {
+		return strings.ReplaceAll(s, "\n", "\r\n")
+	}
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"LF", source, expected},
+		{"CRLF", crlf(source), crlf(expected)},
+		{"BOM", bom + source, bom + expected},
+		{"BOM and CRLF", bom + crlf(source), bom + crlf(expected)},
+		{"Mostly CRLF", crlf(source[:len(source)-2]) + "}\n", crlf(expected)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _, err := processSource("models.go", []byte(tt.source), fileProcessingOptions{out: io.Discard, fixMode: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("processSource() = %q; want %q", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxInstantiations bounds the number of instantiations collected for a file, e.g. for instantiation cycles
+const maxInstantiations = 100
+
+// instantiation is a concrete instantiation of a generic structure, e.g. "Pair[int, string]"
+type instantiation struct {
+	Name string
+	// args contains the type arguments by type parameter object
+	args       map[*ast.Object]ast.Expr
+	BeforeSize uintptr
+	AfterSize  uintptr
+	guesses
+}
+
+// saving returns the number of bytes the optimization frees in the instantiation.
+func (i *instantiation) saving() int {
+	return int(i.BeforeSize) - int(i.AfterSize)
+}
+
+// isGeneric reports whether the structure is a generic type.
+func isGeneric(structure *Structure) bool {
+	return structure.Root != nil && structure.Root.TypeParams != nil
+}
+
+// isTypeParam reports whether the identifier refers to a type parameter.
+func isTypeParam(ident *ast.Ident) bool {
+	if ident.Obj == nil || ident.Obj.Kind != ast.Typ {
+		return false
+	}
+	_, ok := ident.Obj.Decl.(*ast.Field)
+	return ok
+}
+
+// hasTypeParams reports whether the node refers to type parameters.
+func hasTypeParams(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && isTypeParam(ident) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// instantiatedType returns the declaration of the generic type and the type arguments of an instantiation,
+// e.g. "Pair[int, string]", nil if the expression isn't an instantiation of a type declared in the package.
+func instantiatedType(expr ast.Expr) (*ast.TypeSpec, []ast.Expr) {
+	var x ast.Expr
+	var indices []ast.Expr
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		x, indices = t.X, []ast.Expr{t.Index}
+	case *ast.IndexListExpr:
+		x, indices = t.X, t.Indices
+	default:
+		return nil, nil
+	}
+	ident, ok := x.(*ast.Ident)
+	if !ok {
+		return nil, nil
+	}
+	spec := typeSpecOf(ident)
+	if spec == nil || spec.TypeParams == nil {
+		return nil, nil
+	}
+	return spec, indices
+}
+
+// typeArguments maps the type parameters of the generic type to the type arguments.
+func typeArguments(spec *ast.TypeSpec, indices []ast.Expr) map[*ast.Object]ast.Expr {
+	args := make(map[*ast.Object]ast.Expr, len(indices))
+	i := 0
+	for _, field := range spec.TypeParams.List {
+		for _, name := range field.Names {
+			if i < len(indices) && name.Obj != nil {
+				args[name.Obj] = indices[i]
+			}
+			i++
+		}
+	}
+	return args
+}
+
+// instantiationName returns the name of an instantiation, e.g. "Pair[int, string]".
+func instantiationName(spec *ast.TypeSpec, indices []ast.Expr) string {
+	names := make([]string, len(indices))
+	for i, index := range indices {
+		names[i] = types.ExprString(index)
+	}
+	return spec.Name.Name + "[" + strings.Join(names, ", ") + "]"
+}
+
+// substituteTypeParams returns the type with the type arguments substituted for the type parameters.
+// The nodes containing type parameters are copied, the type itself is left untouched.
+// Function types are not substituted, their size doesn't depend on type parameters.
+func substituteTypeParams(expr ast.Expr, args map[*ast.Object]ast.Expr) ast.Expr {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if arg, ok := args[t.Obj]; ok {
+			return arg
+		}
+	case *ast.ParenExpr:
+		copied := *t
+		copied.X = substituteTypeParams(t.X, args)
+		return &copied
+	case *ast.StarExpr:
+		copied := *t
+		copied.X = substituteTypeParams(t.X, args)
+		return &copied
+	case *ast.ArrayType:
+		copied := *t
+		copied.Elt = substituteTypeParams(t.Elt, args)
+		return &copied
+	case *ast.MapType:
+		copied := *t
+		copied.Key = substituteTypeParams(t.Key, args)
+		copied.Value = substituteTypeParams(t.Value, args)
+		return &copied
+	case *ast.ChanType:
+		copied := *t
+		copied.Value = substituteTypeParams(t.Value, args)
+		return &copied
+	case *ast.StructType:
+		fields := *t.Fields
+		fields.List = make([]*ast.Field, len(t.Fields.List))
+		for i, field := range t.Fields.List {
+			copiedField := *field
+			copiedField.Type = substituteTypeParams(field.Type, args)
+			fields.List[i] = &copiedField
+		}
+		copied := *t
+		copied.Fields = &fields
+		return &copied
+	case *ast.IndexExpr:
+		copied := *t
+		copied.Index = substituteTypeParams(t.Index, args)
+		return &copied
+	case *ast.IndexListExpr:
+		copied := *t
+		copied.Indices = make([]ast.Expr, len(t.Indices))
+		for i, index := range t.Indices {
+			copied.Indices[i] = substituteTypeParams(index, args)
+		}
+		return &copied
+	}
+	return expr
+}
+
+// collectInstantiations sets the concrete instantiations of the generic structures declared in the file,
+// used in the file or in the other files of its package (see siblingFiles). Instantiations referring to type
+// parameters, e.g. "Inner[T]" in the declaration of "Outer[T any]", are collected for each instantiation
+// of the enclosing type. The path is empty for sources which aren't files, only the file is used then.
+func collectInstantiations(path string, file *ast.File, structures []*Structure) {
+	generics := make(map[string]*Structure)
+	for _, structure := range structures {
+		if isGeneric(structure) && structure.Scope == "" {
+			generics[structure.Name] = structure
+		}
+	}
+	if len(generics) == 0 {
+		return
+	}
+
+	files := []*ast.File{file}
+	if path != "" {
+		// The package contains a copy of the file itself
+		pkg := siblingFiles(path, file)
+		names := make([]string, 0, len(pkg.files))
+		for name := range pkg.files {
+			if name != filepath.Base(path) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			files = append(files, pkg.files[name])
+		}
+	}
+
+	type instance struct {
+		spec    *ast.TypeSpec
+		indices []ast.Expr
+	}
+	var queue []instance
+	seen := make(map[string]bool)
+	add := func(spec *ast.TypeSpec, indices []ast.Expr) {
+		if len(seen) >= maxInstantiations {
+			return
+		}
+		for _, index := range indices {
+			if hasTypeParams(index) {
+				return
+			}
+		}
+		name := instantiationName(spec, indices)
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		queue = append(queue, instance{spec: spec, indices: indices})
+		// Types are matched by name, other files refer to their own copy of the declaration
+		if structure, ok := generics[spec.Name.Name]; ok {
+			structure.MetaData.Instantiations = append(structure.MetaData.Instantiations, &instantiation{
+				Name: name,
+				args: typeArguments(structure.Root, indices),
+			})
+		}
+	}
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if expr, ok := n.(ast.Expr); ok {
+				if spec, indices := instantiatedType(expr); spec != nil {
+					add(spec, indices)
+				}
+			}
+			return true
+		})
+	}
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+		args := typeArguments(item.spec, item.indices)
+		ast.Inspect(item.spec.Type, func(n ast.Node) bool {
+			if expr, ok := n.(ast.Expr); ok {
+				if spec, indices := instantiatedType(expr); spec != nil {
+					substituted := make([]ast.Expr, len(indices))
+					for i, index := range indices {
+						substituted[i] = substituteTypeParams(index, args)
+					}
+					add(spec, substituted)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// instantiationType returns the function returning the type of a field in the instantiation,
+// with the type arguments substituted for the type parameters.
+func instantiationType(args map[*ast.Object]ast.Expr) func(field *Structure) ast.Expr {
+	return func(field *Structure) ast.Expr {
+		return substituteTypeParams(field.StructType, args)
+	}
+}
+
+// typeLayout returns the function returning the size and alignment of a field with the type returned by typeOf.
+func typeLayout(typeOf func(field *Structure) ast.Expr) func(field *Structure) (uintptr, uintptr) {
+	return func(field *Structure) (uintptr, uintptr) {
+		expr := typeOf(field)
+		return getFieldSize(expr), getFieldAlign(expr)
+	}
+}
+
+// instantiationSizes returns the sizes of the instantiations with the fields in the given order.
+func instantiationSizes(fields []*Structure, instantiations []*instantiation) (sizes []uintptr, total uintptr) {
+	sizes = make([]uintptr, len(instantiations))
+	for i, inst := range instantiations {
+		sizes[i], _ = layoutFields(fields, typeLayout(instantiationType(inst.args)))
+		total += sizes[i]
+	}
+	return sizes, total
+}
+
+// calculateInstantiations calculates the sizes of the instantiations of a generic structure before or after
+// optimization. Once optimized, the structure is reported with the sizes of the instantiation which frees
+// the most bytes.
+func calculateInstantiations(structure *Structure, isBefore bool) {
+	instantiations := structure.MetaData.Instantiations
+	for _, inst := range instantiations {
+		typeOf := instantiationType(inst.args)
+		size, _ := layoutFields(structure.NestedFields, typeLayout(typeOf))
+		if isBefore {
+			inst.BeforeSize = size
+			inst.guesses.init(structure.NestedFields, typeOf)
+		} else {
+			// Savings must not depend on guessed sizes
+			inst.AfterSize = inst.guesses.afterSize(inst.BeforeSize, size, structure.NestedFields, typeOf)
+		}
+	}
+	if isBefore {
+		// The structure is partially analyzed if any of its instantiations is
+		found := make(map[string]bool)
+		structure.MetaData.UnknownTypes = nil
+		for _, inst := range instantiations {
+			for _, name := range inst.UnknownTypes {
+				if !found[name] {
+					found[name] = true
+					structure.MetaData.UnknownTypes = append(structure.MetaData.UnknownTypes, name)
+				}
+			}
+		}
+		sort.Strings(structure.MetaData.UnknownTypes)
+		return
+	}
+	reported := instantiations[0]
+	for _, inst := range instantiations[1:] {
+		if inst.saving() > reported.saving() {
+			reported = inst
+		}
+	}
+	structure.MetaData.BeforeSize = reported.BeforeSize
+	structure.MetaData.AfterSize = reported.AfterSize
+}
+
+// optimizeGenericStructure reorders the fields of a generic structure.
+//
+// Without observed instantiations, the fields whose size depends on type parameters are unknown and left in place,
+// see optimizeAnchoredStructure. Otherwise, the order is chosen among the optimal orders of the instantiations
+// and the order with these fields left in place: the one with the smallest total size of the instantiations,
+// provided it is no worse than the current order for any instantiation. The current order is kept if no order
+// is better. Fields of unknown size in an instantiation are left in place in its optimal order.
+func optimizeGenericStructure(structure *Structure) {
+	fields := structure.NestedFields
+	anchored := optimizeAnchoredStructure(fields, isUnknown)
+	instantiations := structure.MetaData.Instantiations
+	if len(instantiations) == 0 {
+		structure.NestedFields = anchored
+		return
+	}
+
+	candidates := [][]*Structure{anchored}
+	for _, inst := range instantiations {
+		typeOf := instantiationType(inst.args)
+		candidates = append(candidates, anchorFields(fields, func(field *Structure) bool {
+			return hasUnknownSize(field, typeOf)
+		}, typeLayout(typeOf)))
+	}
+	current, best := instantiationSizes(fields, instantiations)
+	optimized := fields
+	for _, candidate := range candidates {
+		sizes, total := instantiationSizes(candidate, instantiations)
+		if total < best && noWorse(sizes, current) {
+			optimized, best = candidate, total
+		}
+	}
+	updateOffsets(optimized)
+	structure.NestedFields = optimized
+}
+
+// noWorse reports whether none of the sizes is greater than the corresponding current size.
+func noWorse(sizes, current []uintptr) bool {
+	for i := range sizes {
+		if sizes[i] > current[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// genericSource declares generic structures and instantiates them
+const genericSource = `package models
+
+type Pair[K comparable, V any] struct {
+	ok  bool
+	key K
+	n   int64
+	val V
+}
+
+type Outer[T any] struct {
+	flag  bool
+	inner Inner[T]
+	b     bool
+}
+
+type Inner[T any] struct {
+	a bool
+	v T
+	b int32
+}
+
+type Unused[T any] struct {
+	a bool
+	v T
+	b int64
+	c bool
+}
+
+type Uses struct {
+	p Pair[int8, string]
+	o Outer[bool]
+}
+
+var _ Pair[int64, bool]
+`
+
+// optimizeSource parses, calculates and optimizes the structures of the source.
+func optimizeSource(t *testing.T, src string) map[string]*Structure {
+	t.Helper()
+	structures, mapper, err := ParseStrings(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calculateStructures(structures, true)
+	optimizeMapperStructures(mapper)
+	calculateStructures(structures, false)
+	return mapper
+}
+
+// fieldOrder returns the names of the fields of the structure, separated by commas.
+func fieldOrder(structure *Structure) string {
+	names := make([]string, len(structure.NestedFields))
+	for i, field := range structure.NestedFields {
+		names[i] = field.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// TestInstantiationSizes tests that fields of instantiated generic types have the layout of the instantiation.
+func TestInstantiationSizes(t *testing.T) {
+	type Pair struct {
+		ok  bool
+		key int8
+		n   int64
+		val string
+	}
+	type Inner struct {
+		a bool
+		v bool
+		b int32
+	}
+	type Outer struct {
+		flag  bool
+		inner Inner
+		b     bool
+	}
+	type Uses struct {
+		p Pair
+		o Outer
+	}
+
+	structures, mapper, err := ParseStrings(genericSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calculateStructures(structures, true)
+	uses := mapper["Uses"]
+	if uses.Size != unsafe.Sizeof(Uses{}) {
+		t.Errorf("Uses: size %d; want %d", uses.Size, unsafe.Sizeof(Uses{}))
+	}
+	if o := uses.NestedFields[1]; o.Offset != unsafe.Offsetof(Uses{}.o) || o.Size != unsafe.Sizeof(Outer{}) {
+		t.Errorf("Uses.o: offset %d, size %d; want offset %d, size %d",
+			o.Offset, o.Size, unsafe.Offsetof(Uses{}.o), unsafe.Sizeof(Outer{}))
+	}
+}
+
+// TestGenericOptimization tests that generic structures are optimized for their observed instantiations.
+func TestGenericOptimization(t *testing.T) {
+	mapper := optimizeSource(t, genericSource)
+
+	tests := []struct {
+		name           string
+		order          string
+		instantiations string
+	}{
+		// Best order for Pair[int64, bool] which is no worse for Pair[int8, string]
+		{"Pair", "n, key, ok, val", "Pair[int8, string] 32 -> 32, Pair[int64, bool] 32 -> 24"},
+		// Instantiated by Outer[bool]
+		{"Inner", "a, v, b", "Inner[bool] 8 -> 8"},
+		{"Outer", "inner, flag, b", "Outer[bool] 16 -> 12"},
+		// Fields of type parameters are left in place without instantiations
+		{"Unused", "b, v, a, c", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			structure := mapper[tt.name]
+			if order := fieldOrder(structure); order != tt.order {
+				t.Errorf("Unexpected order %q; want %q", order, tt.order)
+			}
+			var instantiations []string
+			for _, inst := range structure.MetaData.Instantiations {
+				instantiations = append(instantiations, fmt.Sprintf("%s %d -> %d", inst.Name, inst.BeforeSize, inst.AfterSize))
+			}
+			if got := strings.Join(instantiations, ", "); got != tt.instantiations {
+				t.Errorf("Unexpected instantiations %q; want %q", got, tt.instantiations)
+			}
+		})
+	}
+
+	// Reported with the instantiation freeing the most bytes
+	pair := mapper["Pair"]
+	if pair.MetaData.BeforeSize != 32 || pair.MetaData.AfterSize != 24 {
+		t.Errorf("Pair: %d(b) -> %d(b); want 32(b) -> 24(b)", pair.MetaData.BeforeSize, pair.MetaData.AfterSize)
+	}
+}
+
+// TestGenericOptimizationNoWorse tests that generic structures are left in place
+// when no order is better for all instantiations.
+func TestGenericOptimizationNoWorse(t *testing.T) {
+	mapper := optimizeSource(t, `package models
+
+type Box[A, B any] struct {
+	a A
+	b B
+	c bool
+}
+
+var _ Box[int64, int8]
+var _ Box[int8, int64]
+`)
+	box := mapper["Box"]
+	// "b, a, c" frees 8 bytes in Box[int8, int64], but takes 8 more in Box[int64, int8]
+	if order := fieldOrder(box); order != "a, b, c" {
+		t.Errorf("Unexpected order %q; want %q", order, "a, b, c")
+	}
+	if box.MetaData.BeforeSize != box.MetaData.AfterSize {
+		t.Errorf("Box: %d(b) -> %d(b); want no saving", box.MetaData.BeforeSize, box.MetaData.AfterSize)
+	}
+}
+
+// TestSiblingInstantiations tests that instantiations in the other files of the package are observed.
+func TestSiblingInstantiations(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"box.go":   "package models\n\ntype Box[T any] struct {\n\ta bool\n\tv T\n\tb int64\n}\n",
+		"uses.go":  "package models\n\ntype Uses struct {\n\tbox Box[Small]\n}\n",
+		"small.go": "package models\n\ntype Small int16\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	structures, mapper, err := parseData(filepath.Join(dir, "box.go"), []byte(files["box.go"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calculateStructures(structures, true)
+	optimizeMapperStructures(mapper)
+	calculateStructures(structures, false)
+	instantiations := mapper["Box"].MetaData.Instantiations
+	if len(instantiations) != 1 || instantiations[0].Name != "Box[Small]" {
+		t.Fatalf("Unexpected instantiations %v", instantiations)
+	}
+	if inst := instantiations[0]; inst.BeforeSize != 16 || inst.AfterSize != 16 {
+		t.Errorf("Box[Small]: %d(b) -> %d(b); want 16(b) -> 16(b)", inst.BeforeSize, inst.AfterSize)
+	}
+}
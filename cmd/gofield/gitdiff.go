@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lineRange is an inclusive range of 1-based line numbers
+type lineRange struct {
+	start int
+	end   int
+}
+
+// fileChanges describes which lines of a file were changed
+type fileChanges struct {
+	// all is set for files which are new for git, every line of them is considered changed
+	all    bool
+	ranges []lineRange
+	// unstaged is set with --staged for files which also have unstaged changes: the ranges of the index
+	// don't match the lines of the file in the working tree, the content of the index is analyzed, see stagedContent
+	unstaged bool
+	// indexPath is the path of the file relative to the root of the repository, set with unstaged
+	indexPath string
+}
+
+// overlaps checks if any changed line is located in the given range.
+func (c *fileChanges) overlaps(r lineRange) bool {
+	if c == nil {
+		return false
+	}
+	if c.all {
+		return true
+	}
+	for _, changed := range c.ranges {
+		if changed.start <= r.end && r.start <= changed.end {
+			return true
+		}
+	}
+	return false
+}
+
+// findChanges returns the changed lines of files using the local git binary, keyed by absolute path.
+//
+// With staged set, only changes in the index are taken into account (as for a pre-commit hook),
+// otherwise changes in the working tree including untracked files. The changes are compared
+// against since, or against HEAD when since is empty. With staged set, files which also have
+// unstaged changes are marked, see fileChanges.unstaged.
+func findChanges(since string, staged bool) (map[string]*fileChanges, error) {
+	root, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root = strings.TrimSpace(root)
+
+	args := []string{"-c", "core.quotePath=false", "diff", "-U0", "--no-color", "--no-ext-diff", "--no-renames"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	if since != "" {
+		args = append(args, since)
+	}
+	args = append(args, "--")
+	diff, err := runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	changes := parseUnifiedDiff(root, []byte(diff))
+
+	if staged {
+		unstaged, err := runGit("-c", "core.quotePath=false", "diff", "--name-only", "--no-renames", "--")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range strings.Split(unstaged, "\n") {
+			if file = strings.TrimSpace(file); file != "" {
+				if c, ok := changes[filepath.Join(root, filepath.FromSlash(file))]; ok {
+					c.unstaged, c.indexPath = true, file
+				}
+			}
+		}
+	} else {
+		untracked, err := runGit("ls-files", "--others", "--exclude-standard", "--full-name", ":/")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range strings.Split(untracked, "\n") {
+			if file = strings.TrimSpace(file); file != "" {
+				changes[filepath.Join(root, filepath.FromSlash(file))] = &fileChanges{all: true}
+			}
+		}
+	}
+	return changes, nil
+}
+
+// stagedContent returns the content of the file in the git index.
+func (c *fileChanges) stagedContent() ([]byte, error) {
+	content, err := runGit("show", ":"+c.indexPath)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+// parseUnifiedDiff parses the output of "git diff -U0" and returns the changed line ranges
+// of the new version of every file, keyed by absolute path.
+//
+//	+++ b/path/file.go
+//	@@ -10,2 +10,3 @@    // <-------- lines 10-12 changed
+//	@@ -20,2 +21,0 @@    // <-------- lines removed after line 21
+func parseUnifiedDiff(root string, diff []byte) map[string]*fileChanges {
+	changes := make(map[string]*fileChanges)
+	var current *fileChanges
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			current = nil
+			name := strings.TrimPrefix(line, "+++ ")
+			if name == "/dev/null" {
+				// Deleted file
+				continue
+			}
+			name = strings.TrimPrefix(name, "b/")
+			path := filepath.Join(root, filepath.FromSlash(name))
+			current = &fileChanges{}
+			changes[path] = current
+		case strings.HasPrefix(line, "@@ ") && current != nil:
+			if r, ok := parseHunkHeader(line); ok {
+				current.ranges = append(current.ranges, r)
+			}
+		}
+	}
+	return changes
+}
+
+// parseHunkHeader extracts the changed line range of the new file from a hunk header.
+// Removed lines are represented by the lines around the removal point.
+func parseHunkHeader(line string) (lineRange, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return lineRange{}, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(fields[2], "+"), ",", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return lineRange{}, false
+	}
+	count := 1
+	if len(parts) == 2 {
+		if count, err = strconv.Atoi(parts[1]); err != nil {
+			return lineRange{}, false
+		}
+	}
+	if count == 0 {
+		return lineRange{start: start, end: start + 1}, true
+	}
+	return lineRange{start: start, end: start + count - 1}, true
+}
+
+// runGit runs the local git binary with the given arguments and returns its output.
+func runGit(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
+
+// lookupChanges returns the changes of the file located at path, resolving symlinks if needed.
+func lookupChanges(changes map[string]*fileChanges, path string) *fileChanges {
+	if c, ok := changes[path]; ok {
+		return c
+	}
+	if realPath, err := filepath.EvalSymlinks(path); err == nil {
+		return changes[realPath]
+	}
+	return nil
+}
+
+// structureLines returns the range of lines occupied by the top-level structure in the source.
+func structureLines(fileData []byte, structure *Structure) lineRange {
+	return lineRange{
+		start: offsetLine(fileData, structure.MetaData.StartPos-1),
+		end:   offsetLine(fileData, structure.MetaData.EndPos-1),
+	}
+}
+
+// offsetLine returns the 1-based line number of the byte offset in the source.
+func offsetLine(fileData []byte, offset int) int {
+	if offset > len(fileData) {
+		offset = len(fileData)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return bytes.Count(fileData[:offset], []byte("\n")) + 1
+}
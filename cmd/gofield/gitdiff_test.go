@@ -0,0 +1,167 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseUnifiedDiff tests parsing of "git diff -U0" output.
+func TestParseUnifiedDiff(t *testing.T) {
+	diff := `diff --git a/a.go b/a.go
+index 3dc5e49..23efb1b 100644
+--- a/a.go
++++ b/a.go
+@@ -12,0 +13 @@ type B struct {
++	d bool
+@@ -20,3 +21,2 @@ func main() {
+-	x := 1
++	x := 2
+@@ -30,2 +30,0 @@
+-	removed
+-	removed
+diff --git a/pkg/b.go b/pkg/b.go
+deleted file mode 100644
+--- a/pkg/b.go
++++ /dev/null
+@@ -1,3 +0,0 @@
+-package pkg
+`
+	root := filepath.FromSlash("/repo")
+	changes := parseUnifiedDiff(root, []byte(diff))
+	expected := map[string]*fileChanges{
+		filepath.Join(root, "a.go"): {ranges: []lineRange{{13, 13}, {21, 22}, {30, 31}}},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("parseUnifiedDiff() = %+v; want %+v", changes, expected)
+	}
+}
+
+// TestSelectChangedStructures tests that only structures overlapping changed lines are selected.
+func TestSelectChangedStructures(t *testing.T) {
+	source := []byte(`package main
+
+type A struct {
+	a bool
+	b int64
+	c bool
+}
+
+type B struct {
+	a bool
+	b int64
+	c bool
+}
+
+type (
+	C struct {
+		a bool
+	}
+)
+`)
+	structures, _, err := Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		changes  *fileChanges
+		expected []string
+	}{
+		{"No changes", nil, nil},
+		{"New file", &fileChanges{all: true}, []string{"A", "B", "C"}},
+		{"Field changed", &fileChanges{ranges: []lineRange{{11, 11}}}, []string{"B"}},
+		{"Type line changed", &fileChanges{ranges: []lineRange{{3, 3}}}, []string{"A"}},
+		{"Between structures", &fileChanges{ranges: []lineRange{{8, 8}}}, nil},
+		{"Type block", &fileChanges{ranges: []lineRange{{17, 17}, {1, 2}}}, []string{"C"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, structure := range selectChangedStructures(source, structures, tt.changes) {
+				names = append(names, structure.Name)
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("selectChangedStructures() = %v; want %v", names, tt.expected)
+			}
+		})
+	}
+}
+
+// TestFindChangesStagedWithUnstaged tests that the staged content of files with unstaged changes is analyzed
+// with --staged, and that such files are not fixed.
+func TestFindChangesStagedWithUnstaged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := "package main\n\ntype A struct {\n\ta bool\n}\n"
+	write("a.go", source)
+	write("b.go", source)
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+	changed := "package main\n\ntype A struct {\n\ta bool\n\tb int64\n\tc bool\n}\n"
+	write("a.go", changed)
+	write("b.go", changed)
+	git("add", ".")
+	write("a.go", "// Unstaged\n"+changed)
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workDir)
+	changes, err := findChanges("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := lookupChanges(changes, filepath.Join(root, "a.go")), lookupChanges(changes, filepath.Join(root, "b.go"))
+	if a == nil || !a.unstaged || b == nil || b.unstaged {
+		t.Fatalf("Expected only a.go to have unstaged changes, got a: %+v, b: %+v", a, b)
+	}
+
+	// The unstaged line shifts the structure in the working tree
+	opts := fileProcessingOptions{onlyChanged: true, changes: a, out: io.Discard}
+	_, findings, err := processFile(filepath.Join(dir, "a.go"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].line != 3 {
+		t.Errorf("Expected a finding for the staged structure at line 3, got %+v", findings)
+	}
+	opts.fixMode = true
+	if _, _, err := processFile(filepath.Join(dir, "a.go"), opts); err == nil || !strings.Contains(err.Error(), "unstaged") {
+		t.Errorf("Expected a.go not to be fixed, got: %v", err)
+	}
+	opts.changes = b
+	if _, _, err := processFile(filepath.Join(dir, "b.go"), opts); err != nil {
+		t.Errorf("Unexpected error for b.go: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ignoreFileNames are the names of files which contain ignore rules.
+// Both files use the .gitignore syntax with doublestar (**) globs.
+var ignoreFileNames = []string{".gitignore", ".gofieldignore"}
+
+// ignoreRule is a single pattern from an ignore file
+type ignoreRule struct {
+	// pattern is a doublestar pattern relative to the folder of the ignore file
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// parseIgnoreRules parses the content of an ignore file.
+//
+//	# comment
+//	*.pb.go         // <-------- matches at any depth: "**/*.pb.go"
+//	/generated/     // <-------- anchored folder: "generated"
+//	internal/**/mock_*.go
+//	!keep.pb.go     // <-------- re-includes a file
+func parseIgnoreRules(data []byte) []ignoreRule {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			// Escaped "#" or "!"
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "/") {
+			// Patterns with a slash are relative to the folder of the ignore file
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			// Patterns without a slash match at any depth
+			line = "**/" + line
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignoreMatcher decides whether paths are excluded by .gitignore and .gofieldignore files.
+// Ignore files are loaded lazily, once per folder.
+type ignoreMatcher struct {
+	rules   map[string][]ignoreRule
+	ignored map[string]bool
+}
+
+// newIgnoreMatcher creates an empty ignoreMatcher.
+func newIgnoreMatcher() *ignoreMatcher {
+	return &ignoreMatcher{
+		rules:   make(map[string][]ignoreRule),
+		ignored: make(map[string]bool),
+	}
+}
+
+// dirRules returns the rules of all ignore files located in the given folder.
+func (m *ignoreMatcher) dirRules(dir string) []ignoreRule {
+	if rules, ok := m.rules[dir]; ok {
+		return rules
+	}
+	var rules []ignoreRule
+	for _, name := range ignoreFileNames {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		rules = append(rules, parseIgnoreRules(data)...)
+	}
+	m.rules[dir] = rules
+	return rules
+}
+
+// isIgnored checks if the path is excluded by the ignore files located in root and in the folders
+// between root and the path. A path is also ignored when one of its parent folders is ignored.
+func (m *ignoreMatcher) isIgnored(root, path string, isDir bool) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	if parent := filepath.Dir(path); parent != root {
+		if m.isIgnoredDir(root, parent) {
+			return true
+		}
+	}
+	return m.matchRules(root, path, isDir)
+}
+
+// isIgnoredDir is a cached version of isIgnored for folders.
+func (m *ignoreMatcher) isIgnoredDir(root, dir string) bool {
+	key := root + string(os.PathListSeparator) + dir
+	if ignored, ok := m.ignored[key]; ok {
+		return ignored
+	}
+	ignored := m.isIgnored(root, dir, true)
+	m.ignored[key] = ignored
+	return ignored
+}
+
+// matchRules applies the rules of every folder from root down to the parent folder of the path.
+// The last matching rule wins, so deeper ignore files and later lines override earlier ones.
+func (m *ignoreMatcher) matchRules(root, path string, isDir bool) bool {
+	rel, _ := filepath.Rel(root, filepath.Dir(path))
+	dirs := []string{root}
+	if rel != "." {
+		current := root
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			current = filepath.Join(current, part)
+			dirs = append(dirs, current)
+		}
+	}
+
+	ignored := false
+	for _, dir := range dirs {
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			continue
+		}
+		relPath = filepath.ToSlash(relPath)
+		for _, rule := range m.dirRules(dir) {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if ok, _ := doublestar.Match(rule.pattern, relPath); ok {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// findIgnoreRoot returns the folder whose ignore files apply to everything under dir:
+// the nearest git repository root, otherwise the nearest module root, otherwise dir itself.
+func findIgnoreRoot(dir string) string {
+	for _, marker := range []string{".git", "go.mod"} {
+		current := dir
+		for {
+			if _, err := os.Stat(filepath.Join(current, marker)); err == nil {
+				return current
+			}
+			parent := filepath.Dir(current)
+			if parent == current {
+				break
+			}
+			current = parent
+		}
+	}
+	return dir
+}
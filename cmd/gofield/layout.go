@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// structLayout is the computed memory layout of a top-level structure
+type structLayout struct {
+	Package string        `json:"package"`
+	Type    string        `json:"type"`
+	Size    uintptr       `json:"size"`
+	Align   uintptr       `json:"align"`
+	Fields  []fieldLayout `json:"fields"`
+	// path and line locate the declaration in reports, they are not stored
+	path string
+	line int
+	// generic is set for generic types, whose layout depends on the type arguments
+	generic bool
+	// partial is set for structures with fields of unknown or zero size, whose computed layout may differ
+	// from the compiler's one, see isPartialLayout
+	partial bool
+}
+
+// fieldLayout is the computed memory layout of a structure field
+type fieldLayout struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Offset uintptr `json:"offset"`
+	Size   uintptr `json:"size"`
+	Align  uintptr `json:"align"`
+	// Embedded is set for embedded fields, named after their type
+	Embedded bool `json:"embedded,omitempty"`
+}
+
+// packageLayouts are the layouts of the structures declared in a package folder
+type packageLayouts struct {
+	dir     string
+	name    string
+	layouts []structLayout
+}
+
+// key returns the qualified name of the structure, e.g. "example.com/pkg.User".
+func (l structLayout) key() string {
+	return l.Package + "." + l.Type
+}
+
+// location returns the position of the declaration for reports, or the qualified name when it is unknown.
+func (l structLayout) location() string {
+	if l.path == "" {
+		return l.key()
+	}
+	return fmt.Sprintf("%s:%d: %s", l.path, l.line, l.key())
+}
+
+// embeddedFieldName returns the name of an embedded field from its type, e.g. "Time" for "*time.Time".
+func embeddedFieldName(typeStr string) string {
+	name := strings.TrimPrefix(typeStr, "*")
+	if idx := strings.Index(name, "["); idx >= 0 {
+		name = name[:idx]
+	}
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name
+}
+
+// selector returns the name used to select the field in Go code, or an empty string for blank fields.
+func (f fieldLayout) selector() string {
+	if f.Embedded {
+		return embeddedFieldName(f.Type)
+	}
+	if f.Name == "_" {
+		return ""
+	}
+	return f.Name
+}
+
+// newStructLayout creates the layout of a calculated structure.
+func newStructLayout(pkg string, structure *Structure) structLayout {
+	layout := structLayout{
+		Package: pkg,
+		Type:    structure.Path,
+		Size:    structure.Size,
+		Align:   structure.Align,
+		Fields:  make([]fieldLayout, 0, len(structure.NestedFields)),
+	}
+	for _, field := range structure.NestedFields {
+		layout.Fields = append(layout.Fields, fieldLayout{
+			Name:     strings.TrimPrefix(field.Name, "!"),
+			Type:     field.StringType,
+			Offset:   field.Offset,
+			Size:     field.Size,
+			Align:    field.Align,
+			Embedded: strings.HasPrefix(field.Name, "!"),
+		})
+	}
+	return layout
+}
+
+// fileLayouts computes the layouts of the structures declared in the source of the package, in their current order.
+func fileLayouts(path, pkg string, fileData []byte) ([]structLayout, error) {
+	structures, _, err := parseData(path, fileData)
+	if err != nil {
+		return nil, err
+	}
+	calculateStructures(structures, true)
+
+	data := normalizeLineEndings(fileData)
+	layouts := make([]structLayout, 0, len(structures))
+	for _, structure := range structures {
+		if structure.Root == nil || structure.Scope != "" {
+			// Anonymous and function-local structures cannot be referred to by name
+			continue
+		}
+		layout := newStructLayout(pkg, structure)
+		layout.path = path
+		layout.line = offsetLine(data, structure.MetaData.StartPos-1)
+		layout.generic = structure.Root != nil && structure.Root.TypeParams != nil
+		layout.partial = isPartialLayout(structure)
+		layouts = append(layouts, layout)
+	}
+	return layouts, nil
+}
+
+// isPartialLayout reports whether the layout of the structure is partially guessed: fields of unknown size
+// (see isSizeKnown), or fields of zero size, which add padding at the end of a structure.
+func isPartialLayout(structure *Structure) bool {
+	if len(structure.MetaData.UnknownTypes) > 0 || structure.Unknown {
+		return true
+	}
+	var hasZeroSize func(fields []*Structure) bool
+	hasZeroSize = func(fields []*Structure) bool {
+		for _, field := range fields {
+			if field.Size == 0 || (field.IsStructure && hasZeroSize(field.NestedFields)) {
+				return true
+			}
+		}
+		return false
+	}
+	return hasZeroSize(structure.NestedFields)
+}
+
+// collectLayouts computes the layouts of the structures declared in the files, sorted by qualified name.
+func collectLayouts(files []string) ([]structLayout, error) {
+	var layouts []structLayout
+	for _, path := range files {
+		fileData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read file '%s': %w", path, err)
+		}
+		items, err := fileLayouts(path, packageImportPath(path, fileData), fileData)
+		if err != nil {
+			return nil, fmt.Errorf("cannot process file '%s': %w", path, err)
+		}
+		layouts = append(layouts, items...)
+	}
+	sortLayouts(layouts)
+	return layouts, nil
+}
+
+// sortLayouts sorts layouts by qualified name.
+func sortLayouts(layouts []structLayout) {
+	sort.SliceStable(layouts, func(i, j int) bool {
+		return layouts[i].key() < layouts[j].key()
+	})
+}
+
+// selectLayouts returns the layouts of the given types, all layouts when no types are given.
+// Types are matched by name ("User") or qualified name ("example.com/pkg.User").
+func selectLayouts(layouts []structLayout, types []string) []structLayout {
+	if len(types) == 0 {
+		return layouts
+	}
+	selected := make(map[string]bool, len(types))
+	for _, name := range types {
+		selected[name] = true
+	}
+	var result []structLayout
+	for _, layout := range layouts {
+		if selected[layout.Type] || selected[layout.key()] {
+			result = append(result, layout)
+		}
+	}
+	return result
+}
+
+// collectPackageLayouts groups the layouts of the selected structures by package folder.
+// Structures declared in test files are skipped, as well as folders without selected structures.
+func collectPackageLayouts(files []string, types []string) ([]*packageLayouts, error) {
+	packages := make(map[string]*packageLayouts)
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		fileData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read file '%s': %w", path, err)
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, fileData, parser.PackageClauseOnly)
+		if err != nil {
+			return nil, fmt.Errorf("cannot process file '%s': %w", path, err)
+		}
+		layouts, err := fileLayouts(path, packageImportPath(path, fileData), fileData)
+		if err != nil {
+			return nil, fmt.Errorf("cannot process file '%s': %w", path, err)
+		}
+		layouts = selectLayouts(layouts, types)
+		if len(layouts) == 0 {
+			continue
+		}
+		dir := filepath.Dir(path)
+		pkg, ok := packages[dir]
+		if !ok {
+			pkg = &packageLayouts{dir: dir, name: file.Name.Name}
+			packages[dir] = pkg
+		}
+		pkg.layouts = append(pkg.layouts, layouts...)
+	}
+
+	result := make([]*packageLayouts, 0, len(packages))
+	for _, pkg := range packages {
+		sortLayouts(pkg.layouts)
+		result = append(result, pkg)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].dir < result[j].dir
+	})
+	return result, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// lockVersion is the version of the lock file format
+const lockVersion = 1
+
+// defaultLockFile is the default path of the lock file
+const defaultLockFile = "gofield.lock"
+
+// lockFile is the content of a lock file: the layouts of locked structures
+type lockFile struct {
+	Version int            `json:"version"`
+	Structs []structLayout `json:"structs"`
+}
+
+// writeLockFile writes the layouts to a lock file.
+func writeLockFile(path string, layouts []structLayout) error {
+	file := lockFile{
+		Version: lockVersion,
+		Structs: layouts,
+	}
+	if file.Structs == nil {
+		file.Structs = []structLayout{}
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode lock file: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write lock file: %w", err)
+	}
+	return nil
+}
+
+// loadLockFile reads the layouts from a lock file.
+func loadLockFile(path string) ([]structLayout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read lock file: %w", err)
+	}
+	var file lockFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("cannot parse lock file: %w", err)
+	}
+	if file.Version != lockVersion {
+		return nil, fmt.Errorf("unsupported lock file version %d", file.Version)
+	}
+	return file.Structs, nil
+}
+
+// diffLayouts describes the differences of the current layout of a structure with the locked one.
+// Returns nil when the size, alignment and field offsets didn't change.
+func diffLayouts(locked, current structLayout) []string {
+	var diffs []string
+	if locked.Size != current.Size {
+		diffs = append(diffs, fmt.Sprintf("size changed %d(b) -> %d(b)", locked.Size, current.Size))
+	}
+	if locked.Align != current.Align {
+		diffs = append(diffs, fmt.Sprintf("align changed %d -> %d", locked.Align, current.Align))
+	}
+
+	currentFields := make(map[string]fieldLayout, len(current.Fields))
+	for _, field := range current.Fields {
+		currentFields[field.Name] = field
+	}
+	lockedFields := make(map[string]bool, len(locked.Fields))
+	for _, field := range locked.Fields {
+		lockedFields[field.Name] = true
+		currentField, ok := currentFields[field.Name]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("field %s removed", field.Name))
+		case field.Offset != currentField.Offset:
+			diffs = append(diffs, fmt.Sprintf("field %s offset changed %d -> %d", field.Name, field.Offset, currentField.Offset))
+		case field.Size != currentField.Size:
+			diffs = append(diffs, fmt.Sprintf("field %s size changed %d(b) -> %d(b)", field.Name, field.Size, currentField.Size))
+		}
+	}
+	for _, field := range current.Fields {
+		if !lockedFields[field.Name] {
+			diffs = append(diffs, fmt.Sprintf("field %s added at offset %d", field.Name, field.Offset))
+		}
+	}
+	return diffs
+}
+
+// runLock runs the "lock" command: writes the layouts of selected structures to the lock file,
+// or compares current layouts with the lock file in check mode.
+func runLock(args []string) int {
+	fs := newCommandFlagSet("lock", "gofield lock [--check] [--lock-file gofield.lock] [--types A,B] [--files ./...]")
+	discovery := addDiscoveryFlags(fs, ".")
+	lockFilePath := fs.String("lock-file", defaultLockFile, "Path of the lock file")
+	typesFlag := fs.String("types", "", "Comma-separated list of structures to lock, by name or qualified name (default: all)")
+	checkFlag := fs.Bool("check", false, "Compare current layouts with the lock file instead of writing it")
+	typesFileFlag := addTypesFileFlag(fs)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if err := useTypesFile(*typesFileFlag); err != nil {
+		return commandErrorf("Cannot load types file: %v\n", err)
+	}
+
+	files, err := discovery.findFiles()
+	if err != nil {
+		return commandErrorf("%v\n", err)
+	}
+	layouts, err := collectLayouts(files)
+	if err != nil {
+		return commandErrorf("%v\n", err)
+	}
+	types := splitAndTrim(*typesFlag)
+
+	if !*checkFlag {
+		selected := selectLayouts(layouts, types)
+		if err := writeLockFile(*lockFilePath, selected); err != nil {
+			return commandErrorf("%v\n", err)
+		}
+		fmt.Printf("Locked %d structures in %s\n", len(selected), *lockFilePath)
+		return 0
+	}
+
+	locked, err := loadLockFile(*lockFilePath)
+	if err != nil {
+		return commandErrorf("%v\n", err)
+	}
+	current := make(map[string]structLayout, len(layouts))
+	for _, layout := range layouts {
+		current[layout.key()] = layout
+	}
+	changed := 0
+	for _, lockedLayout := range selectLayouts(locked, types) {
+		layout, ok := current[lockedLayout.key()]
+		if !ok {
+			fmt.Printf("%s: not found\n", lockedLayout.key())
+			changed++
+			continue
+		}
+		diffs := diffLayouts(lockedLayout, layout)
+		for _, diff := range diffs {
+			fmt.Printf("%s: %s\n", layout.location(), diff)
+		}
+		if len(diffs) > 0 {
+			changed++
+		}
+	}
+	if changed > 0 {
+		fmt.Printf("%d locked structures changed, run \"gofield lock\" to accept the new layouts\n", changed)
+		return exitCodeFindings
+	}
+	return 0
+}
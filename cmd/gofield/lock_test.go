@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestDiffLayouts tests the description of layout changes of a locked structure.
+func TestDiffLayouts(t *testing.T) {
+	locked := structLayout{
+		Size:  16,
+		Align: 8,
+		Fields: []fieldLayout{
+			{Name: "a", Type: "int64", Offset: 0, Size: 8},
+			{Name: "b", Type: "int32", Offset: 8, Size: 4},
+			{Name: "c", Type: "bool", Offset: 12, Size: 1},
+		},
+	}
+	if diffs := diffLayouts(locked, locked); diffs != nil {
+		t.Errorf("Expected no differences, got %v", diffs)
+	}
+
+	current := structLayout{
+		Size:  24,
+		Align: 8,
+		Fields: []fieldLayout{
+			{Name: "a", Type: "int64", Offset: 0, Size: 8},
+			{Name: "b", Type: "int64", Offset: 8, Size: 8},
+			{Name: "d", Type: "bool", Offset: 16, Size: 1},
+		},
+	}
+	expected := []string{
+		"size changed 16(b) -> 24(b)",
+		"field b size changed 4(b) -> 8(b)",
+		"field c removed",
+		"field d added at offset 16",
+	}
+	if diffs := diffLayouts(locked, current); !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("diffLayouts() = %q; want %q", diffs, expected)
+	}
+}
+
+// TestLockCommand tests writing a lock file and checking layouts against it.
+func TestLockCommand(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "models.go")
+	lockPath := filepath.Join(dir, "gofield.lock")
+	source := "package models\n\ntype Hot struct {\n\ta int64\n\tb bool\n}\n\ntype Cold struct {\n\ta bool\n}\n"
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runLock([]string{"--files", dir, "--lock-file", lockPath, "--types", "Hot"}); code != 0 {
+		t.Fatalf("Expected exit code 0 when writing the lock file, got %d", code)
+	}
+	locked, err := loadLockFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locked) != 1 || locked[0].Type != "Hot" || locked[0].Size != 16 {
+		t.Fatalf("Unexpected lock file content: %+v", locked)
+	}
+	if code := runLock([]string{"--files", dir, "--lock-file", lockPath, "--check"}); code != 0 {
+		t.Errorf("Expected exit code 0 for unchanged layouts, got %d", code)
+	}
+
+	// Growing an unlocked structure is fine, growing a locked one is not
+	source = "package models\n\ntype Hot struct {\n\ta int64\n\tb bool\n\tc int64\n}\n\ntype Cold struct {\n\ta bool\n\tb int64\n}\n"
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := runLock([]string{"--files", dir, "--lock-file", lockPath, "--check"}); code != exitCodeFindings {
+		t.Errorf("Expected exit code %d for changed layouts, got %d", exitCodeFindings, code)
+	}
+	if code := runLock([]string{"--files", dir, "--lock-file", filepath.Join(dir, "missing.lock"), "--check"}); code != exitCodeErrors {
+		t.Errorf("Expected exit code %d for a missing lock file, got %d", exitCodeErrors, code)
+	}
+}
@@ -3,11 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"regexp"
-	"sort"
 	"strings"
+	"time"
 
 	version "github.com/t34-dev/go-field-alignment/v2"
 )
@@ -15,6 +15,22 @@ import (
 // defaultFilePattern is the default regex pattern for files to process
 const defaultFilePattern = `\.go$`
 
+// Exit codes returned by the program.
+//
+// 0 is returned when there are no findings (or all of them have been fixed).
+const (
+	// exitCodeFindings is returned when some structures can be optimized or exceed their size budget
+	exitCodeFindings = 1
+	// exitCodeErrors is returned on tool errors: invalid flags, files which could not be processed, etc.
+	exitCodeErrors = 2
+)
+
+// fileError describes a failure that occurred while processing a single file
+type fileError struct {
+	path string
+	err  error
+}
+
 // main is the entry point of the program.
 // It handles command-line arguments, processes files based on the provided flags,
 // and applies necessary operations on the found files.
@@ -24,125 +40,325 @@ func main() {
 	// Error logging will go to stderr.
 	log.SetFlags(0)
 
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
 	command := ""
 	if len(os.Args) == 2 {
 		command = strings.TrimSpace(os.Args[1])
 	}
 
 	// Define flags
-	filesFlag := flag.String("files", "", "Comma-separated list of files or folders to process")
-	fFlag := flag.String("f", "", "Short form of --files")
-	ignoreFlag := flag.String("ignore", "", "Comma-separated list of files or folders to ignore")
-	iFlag := flag.String("i", "", "Short form of --ignore")
+	discovery := addDiscoveryFlags(flag.CommandLine, "")
 	viewFlag := flag.Bool("view", false, "Print the absolute paths of found files")
 	vFlag := flag.Bool("v", false, "Short form of --view")
 	fixFlag := flag.Bool("fix", false, "Make changes to the files")
-	filePatternFlag := flag.String("pattern", "", "Regex pattern for files to process")
-	ignorePatternFlag := flag.String("ignore-pattern", "", "Regex pattern for files to ignore")
+	backupFlag := flag.Bool("backup", false, "Store original contents of fixed files in "+backupsDir+" for \"gofield undo\"")
+	noTypeCheckFlag := flag.Bool("no-typecheck", false, "Write fixed files without type-checking their packages first")
+	scopedFormatFlag := flag.Bool("scoped-format", false, "Format only the rewritten structures, leaving the rest of the file untouched")
+	checkFlag := flag.Bool("check", false, "Print one line per finding without making changes, for CI")
+	minBytesFlag := flag.Uint("min-bytes", 0, "Report only structures which can free at least the given number of bytes")
+	minPercentFlag := flag.Float64("min-percent", 0, "Report only structures which can free at least the given percent of their size")
+	minStructSizeFlag := flag.Uint("min-struct-size", 0, "Report only structures of at least the given size in bytes")
 	versionFlag := flag.Bool("version", false, "Print the version of the program")
 	helpFlag := flag.Bool("help", false, "Print usage information")
 	debugFlag := flag.Bool("debug", false, "Enable debug mode")
+	stdinFlag := flag.Bool("stdin", false, "Read Go source from stdin and write the fixed source to stdout (same as \"-\")")
+	stdinFilenameFlag := flag.String("stdin-filename", "", "Path of the source read from stdin, used for ignore files lookup and diagnostics")
+	sinceFlag := flag.String("since", "", "Only analyze structures added or modified since the given git revision")
+	stagedFlag := flag.Bool("staged", false, "Only analyze structures added or modified in the git index (pre-commit)")
+	baselineFlag := flag.String("baseline", "", "Report and fail only on findings not recorded in the given baseline file")
+	writeBaselineFlag := flag.String("write-baseline", "", "Record current findings to the given baseline file")
+	keepGoingFlag := flag.Bool("keep-going", false, "Continue processing when a file fails and report all failures at the end")
+	kFlag := flag.Bool("k", false, "Short form of --keep-going")
+	typesFileFlag := addTypesFileFlag(flag.CommandLine)
 
 	// Parse flags
 	flag.Parse()
 
+	// "gofield -" reads from stdin. Flags after "-" are not parsed by flag.Parse.
+	if flag.Arg(0) == "-" {
+		*stdinFlag = true
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			fatalf("Error parsing flags: %v\n", err)
+		}
+	}
+
 	// Check for version flag
 	if *versionFlag || command == "version" {
 		fmt.Printf("Version: %s\n", version.Version)
 		return
 	}
 
+	if err := useTypesFile(*typesFileFlag); err != nil {
+		fatalf("Cannot load types file: %v\n", err)
+	}
+
+	if *stdinFlag {
+		os.Exit(runStdin(
+			stdinOptions{
+				filename:         *stdinFilenameFlag,
+				includeGenerated: *discovery.includeGenerated,
+			},
+			fileProcessingOptions{
+				viewMode:     *viewFlag || *vFlag,
+				debugMode:    *debugFlag,
+				scopedFormat: *scopedFormatFlag,
+			},
+		))
+	}
+
 	// Check for help flag or missing required flags
-	if *helpFlag || command == "help" || (*filesFlag == "" && *fFlag == "") {
+	if *helpFlag || command == "help" || discovery.isEmpty() {
 		printUsage()
 		return
 	}
 
 	// Merge short and long form flags
-	files := mergeFlags(*filesFlag, *fFlag)
-	ignores := mergeFlags(*ignoreFlag, *iFlag)
-	filePattern := *filePatternFlag
-	ignorePattern := *ignorePatternFlag
 	debugMode := *debugFlag
 	fixMode := *fixFlag
 	viewMode := *viewFlag || *vFlag
+	keepGoing := *keepGoingFlag || *kFlag
+	checkMode := *checkFlag
+
+	if checkMode && fixMode {
+		fatalf("--check cannot be used with --fix\n")
+	}
 
-	// Ensure filePattern is not empty
-	if filePattern == "" {
-		filePattern = defaultFilePattern
+	writeBaselinePath := *writeBaselineFlag
+	if writeBaselinePath != "" && fixMode {
+		fatalf("--write-baseline cannot be used with --fix\n")
 	}
 
-	// Compile regex patterns
-	fileRegex, err := regexp.Compile(filePattern)
+	allFiles, err := discovery.findFiles()
 	if err != nil {
-		log.Fatalf("Error compiling file pattern regex: %v\n", err)
+		fatalf("%v\n", err)
 	}
 
-	var ignoreRegex *regexp.Regexp
-	if ignorePattern != "" {
-		ignoreRegex, err = regexp.Compile(ignorePattern)
-		if err != nil {
-			log.Fatalf("Error compiling ignore pattern regex: %v\n", err)
-		}
+	if !checkMode {
+		fmt.Printf("Files analyzed: %d\n-----------------\n", len(allFiles))
 	}
 
-	ignoresMap, err := findFiles(ignores, fileRegex, ignoreRegex, nil)
-	if err != nil {
-		log.Fatalf("Cannot find files to ignore: %v\n", err)
+	processingOpts := fileProcessingOptions{
+		viewMode:     viewMode,
+		fixMode:      fixMode,
+		debugMode:    debugMode,
+		scopedFormat: *scopedFormatFlag,
+		thresholds: thresholds{
+			minPercent:    *minPercentFlag,
+			minBytes:      uintptr(*minBytesFlag),
+			minStructSize: uintptr(*minStructSizeFlag),
+		},
 	}
-	filesToWork, err := findFiles(files, fileRegex, ignoreRegex, ignoresMap)
-	if err != nil {
-		log.Fatalf("Cannot find files to process: %v\n", err)
+	if checkMode {
+		// Findings are printed after all files have been processed
+		processingOpts.out = io.Discard
 	}
 
-	fmt.Printf("Files analyzed: %d\n-----------------\n", len(filesToWork))
-
-	allFiles := make([]string, 0, len(filesToWork))
-	for filePath := range filesToWork {
-		allFiles = append(allFiles, filePath)
+	// The baseline is rewritten from scratch, so existing entries are not applied
+	if *baselineFlag != "" && writeBaselinePath == "" {
+		processingOpts.baseline, err = loadBaseline(*baselineFlag)
+		if err != nil {
+			fatalf("Cannot load baseline: %v\n", err)
+		}
 	}
-	sort.Strings(allFiles)
 
-	processingOpts := fileProcessingOptions{
-		viewMode:  viewMode,
-		fixMode:   fixMode,
-		debugMode: debugMode,
+	var changes map[string]*fileChanges
+	if *sinceFlag != "" || *stagedFlag {
+		changes, err = findChanges(*sinceFlag, *stagedFlag)
+		if err != nil {
+			fatalf("Cannot find changed lines: %v\n", err)
+		}
+		processingOpts.onlyChanged = true
 	}
 
 	var filesToFix []string
+	var allFindings []finding
+	var failedFiles []fileError
+	var rewrites []rewrite
 	for _, filePath := range allFiles {
-		needFix, err := processFile(filePath, processingOpts)
+		if processingOpts.onlyChanged {
+			processingOpts.changes = lookupChanges(changes, filePath)
+		}
+		result, findings, err := processFile(filePath, processingOpts)
 		if err != nil {
-			log.Fatalf("Cannot process file '%s': %v\n", filePath, err)
+			if !keepGoing {
+				log.Printf("Cannot process file '%s': %v\n", filePath, err)
+				os.Exit(exitCodeErrors)
+			}
+			failedFiles = append(failedFiles, fileError{path: filePath, err: err})
+			continue
 		}
-		if needFix {
+		if len(findings) > 0 {
 			filesToFix = append(filesToFix, filePath)
+			allFindings = append(allFindings, findings...)
+		}
+		if result != nil {
+			rewrites = append(rewrites, rewrite{path: filePath, data: result})
+		}
+	}
+
+	// Fixes are applied to all files or none of them
+	if len(rewrites) > 0 {
+		if len(failedFiles) > 0 {
+			printFailedFiles(failedFiles)
+			fatalf("No files have been written\n")
+		}
+		if !*noTypeCheckFlag {
+			typeErrors, err := typeCheckRewrites(rewrites)
+			if err != nil {
+				fatalf("Cannot type-check fixed files: %v\nNo files have been written\n", err)
+			}
+			if len(typeErrors) > 0 {
+				fatalf("-----------------\nFixed files do not type-check:\n-- %s\nNo files have been written\n", strings.Join(typeErrors, "\n-- "))
+			}
+		}
+		if *backupFlag {
+			runID, err := backupRewrites(rewrites, time.Now())
+			if err != nil {
+				fatalf("Cannot back up files: %v\nNo files have been written\n", err)
+			}
+			fmt.Printf("Original files backed up, run \"gofield undo %s\" to restore them\n", runID)
+		}
+		if err := writeRewrites(rewrites); err != nil {
+			fatalf("Cannot write fixed files: %v\n", err)
 		}
 	}
-	if len(filesToFix) == 0 {
+
+	if writeBaselinePath != "" {
+		if err := writeBaseline(writeBaselinePath, allFindings); err != nil {
+			fatalf("Cannot write baseline: %v\n", err)
+		}
+		fmt.Printf("-----------------\nBaseline with %d findings written to %s\n", len(allFindings), writeBaselinePath)
+		if len(failedFiles) > 0 {
+			printFailedFiles(failedFiles)
+			os.Exit(exitCodeErrors)
+		}
 		return
 	}
+	if processingOpts.baseline != nil {
+		printStaleBaselineEntries(processingOpts.baseline.stale())
+	}
+
+	exitCode := 0
+	if checkMode {
+		printCheckFindings(os.Stdout, allFindings)
+		if len(allFindings) > 0 {
+			fmt.Printf("%d structures in %d files can be optimized\n", len(allFindings), len(filesToFix))
+			exitCode = exitCodeFindings
+		}
+	} else if len(filesToFix) > 0 {
+		if fixMode {
+			fmt.Printf("-----------------\nApplied fixes to %d files\n", countFixedFiles(allFindings))
+			if overBudget := overBudgetFindings(allFindings); len(overBudget) > 0 {
+				fmt.Println("Structures exceeding their max size even after fixes:")
+				for _, item := range overBudget {
+					fmt.Printf("-- %s:%d: %s %d(b) > %d(b)\n", item.path, item.line, item.structure.Path, item.structure.MetaData.AfterSize, item.structure.MetaData.MaxSize)
+				}
+				exitCode = exitCodeFindings
+			}
+		} else {
+			fmt.Printf("-----------------\nFound files that need to be optimized:\n-- %s\n", strings.Join(filesToFix, "\n-- "))
+			exitCode = exitCodeFindings
+		}
+	}
+	if len(failedFiles) > 0 {
+		printFailedFiles(failedFiles)
+		exitCode = exitCodeErrors
+	}
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+	if len(filesToFix) > 0 && !checkMode {
+		fmt.Println()
+	}
+}
+
+// countFixedFiles returns the number of files with structures which have been optimized.
+func countFixedFiles(findings []finding) int {
+	files := make(map[string]bool)
+	for _, item := range findings {
+		if item.optimizable {
+			files[item.path] = true
+		}
+	}
+	return len(files)
+}
+
+// overBudgetFindings returns the findings of structures which exceed their size budget.
+func overBudgetFindings(findings []finding) []finding {
+	var result []finding
+	for _, item := range findings {
+		if item.overBudget {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// fatalf prints the error message and exits with the tool error exit code.
+func fatalf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+	os.Exit(exitCodeErrors)
+}
+
+// printStaleBaselineEntries prints baseline entries which no longer match any finding.
+func printStaleBaselineEntries(entries []baselineEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Printf("-----------------\nStale baseline entries (optimized or changed): %d\n", len(entries))
+	for _, entry := range entries {
+		fmt.Printf("-- %s.%s\n", entry.Package, entry.Type)
+	}
+}
 
-	if fixMode {
-		fmt.Printf("-----------------\nApplied fixes to %d files\n", len(filesToFix))
-	} else {
-		fmt.Printf("-----------------\nFound files that need to be optimized:\n-- %s\n", strings.Join(filesToFix, "\n-- "))
-		os.Exit(1)
+// printFailedFiles prints a summary of the files that could not be processed.
+func printFailedFiles(failedFiles []fileError) {
+	log.Printf("-----------------\nFailed to process %d files:\n", len(failedFiles))
+	for _, failed := range failedFiles {
+		log.Printf("-- %s: %v\n", failed.path, failed.err)
 	}
-	fmt.Println()
 }
 
 // printUsage prints the usage information for the program.
 func printUsage() {
 	fmt.Println("Usage of gofield:")
 	fmt.Println("  gofield --files <files> [options]")
+	fmt.Println("  gofield - [options] < file.go")
+	fmt.Println("  gofield <command> [options]")
+	fmt.Println("\nCommands (run \"gofield <command> --help\" for their options):")
+	fmt.Println("  lock                  Write the layouts of structures to a lock file, or compare them with it (--check)")
+	fmt.Println("  compare               Print structures added, removed, grown or shrunk between two git revisions")
+	fmt.Println("  assert                Generate compile-time assertions of structure layouts in every package folder")
+	fmt.Println("  verify                Compare computed structure layouts with the ones of the local Go compiler")
+	fmt.Println("  undo                  Restore the files fixed by a --fix --backup run (the latest one by default)")
 	fmt.Println("\nOptions:")
-	fmt.Println("  --files, -f            Comma-separated list of files or folders to process (required)")
+	fmt.Println("  --files, -f            Comma-separated list of files, folders or Go package patterns (./..., import paths) to process (required)")
 	fmt.Println("  --ignore, -i          Comma-separated list of files or folders to ignore")
 	fmt.Println("  --view, -v            Print the absolute paths of found files")
 	fmt.Println("  --fix                 Make changes to the files")
+	fmt.Println("  --backup              Store original contents of fixed files in .gofield/backups for \"gofield undo\"")
+	fmt.Println("  --no-typecheck        Write fixed files without type-checking their packages first")
+	fmt.Println("  --scoped-format       Format only the rewritten structures, leaving the rest of the file untouched")
+	fmt.Println("  --check               Print one line per finding without making changes, for CI")
+	fmt.Println("  --min-bytes           Report only structures which can free at least the given number of bytes")
+	fmt.Println("  --min-percent         Report only structures which can free at least the given percent of their size")
+	fmt.Println("  --min-struct-size     Report only structures of at least the given size in bytes")
 	fmt.Println("  --pattern   		  Regex pattern for files to process (default: \\.go$)")
 	fmt.Println("  --ignore-pattern	  Regex pattern for files to ignore")
+	fmt.Println("  --since               Only analyze structures added or modified since the given git revision")
+	fmt.Println("  --staged              Only analyze structures added or modified in the git index (pre-commit)")
+	fmt.Println("  --baseline            Report and fail only on findings not recorded in the given baseline file")
+	fmt.Println("  --write-baseline      Record current findings to the given baseline file")
+	fmt.Println("  --types-file          JSON file with the sizes and alignments of types declared in other packages, cgo types or types excluded by build constraints")
+	fmt.Println("  --stdin, -            Read Go source from stdin and write the fixed source to stdout")
+	fmt.Println("  --stdin-filename      Path of the source read from stdin, used for ignore files lookup and diagnostics")
+	fmt.Println("  --include-generated   Process generated files (// Code generated ... DO NOT EDIT.)")
+	fmt.Println("  --keep-going, -k      Continue when a file cannot be processed and report all failures at the end")
 	fmt.Println("  --version             Print the version of the program")
 	fmt.Println("  --help                Print this help message")
 	fmt.Println("\nExamples:")
@@ -155,4 +371,23 @@ func printUsage() {
 	fmt.Println("  gofield --files \"example\" --ignore-pattern \"_test\\.go$\"")
 	fmt.Println("  gofield --files \"example\" --pattern \"_test\\.go$\"")
 	fmt.Println("  gofield --files example --fix")
+	fmt.Println("  gofield --files ./... --ignore-pattern \"_test\\.go$\"")
+	fmt.Println("  gofield --files example --keep-going")
+	fmt.Println("  gofield --files ./... --since origin/main")
+	fmt.Println("  gofield --files ./... --staged --fix")
+	fmt.Println("  gofield --files ./... --check --min-bytes 8 --min-percent 10 --min-struct-size 64")
+	fmt.Println("  gofield --files ./... --write-baseline .gofield-baseline.json")
+	fmt.Println("  gofield --files ./... --baseline .gofield-baseline.json")
+	fmt.Println("  gofield --files ./... --types-file .gofield-types.json")
+	fmt.Println("  gofield - --stdin-filename example/filex.go < example/filex.go")
+	fmt.Println("  gofield lock --files ./... --types User,Session")
+	fmt.Println("  gofield lock --files ./... --check")
+	fmt.Println("  gofield compare --format json v1.0.0 v1.1.0 ./internal")
+	fmt.Println("  gofield assert --files ./... --types User,Session")
+	fmt.Println("  gofield verify --files ./...")
+	fmt.Println("  gofield --files ./... --fix --backup && gofield undo")
+	fmt.Println("\nExit codes:")
+	fmt.Println("  0  Clean: no structures need to be optimized (or all fixes have been applied)")
+	fmt.Println("  1  Findings: some structures can be optimized or exceed their //gofield:maxsize budget, locked layouts changed")
+	fmt.Println("  2  Tool errors: invalid flags or patterns, files which could not be processed, git errors")
 }
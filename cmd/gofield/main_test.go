@@ -41,10 +41,8 @@ func TestStructAlignment(t *testing.T) {
 	calculateStructures(structures, false)
 	debugPrintStructures(structures)
 
-	renderTextStructures(structures)
-
-	// Replace content
-	resultFile, err := Replacer(enterFIle, structures)
+	// Reorder fields
+	resultFile, err := Rewriter(enterFIle, structures)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -11,17 +11,34 @@ import (
 // It sorts fields by alignment and size, separates regular fields from arrays and slices,
 // and recalculates field offsets for the optimized structure.
 func optimizeStructure(fields []*Structure) []*Structure {
-	// Sort fields in descending order of alignment, then in descending order of size
-	sort.Slice(fields, func(i, j int) bool {
-		if fields[i].Align != fields[j].Align {
-			return fields[i].Align > fields[j].Align
+	optimizedFields := sortFields(fields, func(field *Structure) (uintptr, uintptr) {
+		return field.Size, field.Align
+	})
+	updateOffsets(optimizedFields)
+	return optimizedFields
+}
+
+// sortFields returns the fields in descending order of alignment, then in descending order of size,
+// with arrays and slices at the end. The layout function returns the size and alignment of a field.
+func sortFields(fields []*Structure, layout func(field *Structure) (size, alignment uintptr)) []*Structure {
+	sizes := make(map[*Structure]uintptr, len(fields))
+	aligns := make(map[*Structure]uintptr, len(fields))
+	for _, field := range fields {
+		sizes[field], aligns[field] = layout(field)
+	}
+	sorted := append([]*Structure(nil), fields...)
+
+	// The sort is stable, so fields declared together ("a, b int") stay adjacent.
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if aligns[sorted[i]] != aligns[sorted[j]] {
+			return aligns[sorted[i]] > aligns[sorted[j]]
 		}
-		return fields[i].Size > fields[j].Size
+		return sizes[sorted[i]] > sizes[sorted[j]]
 	})
 
 	// Separately process arrays and slices
 	var regularFields, arrayFields []*Structure
-	for _, field := range fields {
+	for _, field := range sorted {
 		if strings.HasPrefix(field.StringType, "[") || strings.HasPrefix(field.StringType, "[]") {
 			arrayFields = append(arrayFields, field)
 		} else {
@@ -30,26 +47,65 @@ func optimizeStructure(fields []*Structure) []*Structure {
 	}
 
 	// Merge back, placing arrays and slices at the end
-	optimizedFields := append(regularFields, arrayFields...)
+	return append(regularFields, arrayFields...)
+}
 
-	// Recalculate offsets
-	var currentOffset uintptr
-	for i := range optimizedFields {
-		currentOffset = align(currentOffset, optimizedFields[i].Align)
-		optimizedFields[i].Offset = currentOffset
-		currentOffset += optimizedFields[i].Size
+// optimizeAnchoredStructure reorganizes the fields of a structure like optimizeStructure,
+// leaving the anchored fields at their positions, e.g. fields of unknown size.
+func optimizeAnchoredStructure(fields []*Structure, anchored func(field *Structure) bool) []*Structure {
+	optimizedFields := anchorFields(fields, anchored, func(field *Structure) (uintptr, uintptr) {
+		return field.Size, field.Align
+	})
+	updateOffsets(optimizedFields)
+	return optimizedFields
+}
+
+// anchorFields returns the fields sorted like sortFields, with the anchored fields left at their positions.
+func anchorFields(fields []*Structure, anchored func(field *Structure) bool, layout func(field *Structure) (size, alignment uintptr)) []*Structure {
+	var movable []*Structure
+	for _, field := range fields {
+		if !anchored(field) {
+			movable = append(movable, field)
+		}
 	}
+	movable = sortFields(movable, layout)
 
-	return optimizedFields
+	sorted := make([]*Structure, 0, len(fields))
+	for _, field := range fields {
+		if anchored(field) {
+			sorted = append(sorted, field)
+		} else {
+			sorted = append(sorted, movable[0])
+			movable = movable[1:]
+		}
+	}
+	return sorted
+}
+
+// updateOffsets recalculates the offsets of the fields in their current order.
+func updateOffsets(fields []*Structure) {
+	var currentOffset uintptr
+	for i := range fields {
+		currentOffset = align(currentOffset, fields[i].Align)
+		fields[i].Offset = currentOffset
+		currentOffset += fields[i].Size
+	}
 }
 
 // optimizeMapperStructures applies the optimizeStructure function to all structures in the given map.
 // It processes structures in order of their nesting depth (determined by the number of slashes in their path).
+// Fields of unknown size are left in place, and generic structures are optimized for their type arguments,
+// see optimizeGenericStructure.
 func optimizeMapperStructures(mapStructures map[string]*Structure) {
 	mapperItemsFlat := sortMapKeysBySlashCount(mapStructures)
 	for _, structure := range mapperItemsFlat {
-		if structure.IsStructure {
-			structure.NestedFields = optimizeStructure(structure.NestedFields)
+		if !structure.IsStructure {
+			continue
+		}
+		if isGeneric(structure) {
+			optimizeGenericStructure(structure)
+		} else {
+			structure.NestedFields = optimizeAnchoredStructure(structure.NestedFields, isUnknown)
 		}
 	}
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// isPackagePattern checks if the given --files entry is a Go package pattern (./..., ./internal/..., example.com/x/...)
+// rather than a plain file or folder.
+func isPackagePattern(s string) bool {
+	return strings.Contains(s, "...")
+}
+
+// findPackageFiles resolves a Go package pattern or an import path to the list of Go files
+// the go command sees for it.
+//
+// Files are resolved through the go command's package loading, so build constraints,
+// module boundaries and test files are handled the same way "go build" and "go vet" see them.
+func findPackageFiles(pattern string) ([]string, error) {
+	cfg := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles,
+		Tests: true,
+	}
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load packages: %w", err)
+	}
+
+	seen := make(map[string]struct{})
+	var files []string
+	var pkgErrors []string
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			pkgErrors = append(pkgErrors, pkgErr.Msg)
+		}
+		// Skip test binaries generated by the go command - their files live in the build cache
+		if strings.HasSuffix(pkg.ID, ".test") {
+			continue
+		}
+		for _, file := range pkg.GoFiles {
+			if _, ok := seen[file]; ok {
+				continue
+			}
+			seen[file] = struct{}{}
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 && len(pkgErrors) > 0 {
+		return nil, fmt.Errorf("cannot load packages: %s", strings.Join(pkgErrors, "; "))
+	}
+	return files, nil
+}
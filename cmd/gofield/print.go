@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 )
 
@@ -16,10 +18,15 @@ func debugPrintStructures(structures []*Structure) {
 	}
 }
 
-// testPrintStructure recursively prints the structure of an Structure element.
+// testPrintStructure recursively prints the structure of an Structure element to stdout.
+func testPrintStructure(elem *Structure, tab int) {
+	fprintStructure(os.Stdout, elem, tab)
+}
+
+// fprintStructure recursively prints the structure of an Structure element to w.
 // It formats the output to show field names, types, sizes, alignments, and offsets.
 // The function also calculates and displays padding between fields.
-func testPrintStructure(elem *Structure, tab int) {
+func fprintStructure(w io.Writer, elem *Structure, tab int) {
 	// alignment for beautiful display in logs
 	maxFieldNameLength := 0
 	maxTypeLength := 0
@@ -29,6 +36,10 @@ func testPrintStructure(elem *Structure, tab int) {
 			if len(field.Name) > maxFieldNameLength {
 				maxFieldNameLength = len(field.Name)
 			}
+			if field.IsStructure && !isValidCustomTypeName(field.StringType) {
+				// Nested structures are printed field by field
+				continue
+			}
 			if len(field.StringType) > maxTypeLength {
 				maxTypeLength = len(field.StringType)
 			}
@@ -36,19 +47,23 @@ func testPrintStructure(elem *Structure, tab int) {
 		infoFormat := fmt.Sprintf("%s    %%-%ds %%-%ds %%s", strings.Repeat(" ", tab), maxValue(maxFieldNameLength, 5), maxValue(maxTypeLength, 11))
 
 		if tab == 0 {
-			fmt.Printf("%stype %s struct {\n", strings.Repeat(" ", tab), elem.Name)
+			fmt.Fprintf(w, "%stype %s struct {\n", strings.Repeat(" ", tab), elem.Name)
 		} else {
-			fmt.Printf("%s%s struct {\n", strings.Repeat(" ", tab), elem.Name)
+			fmt.Fprintf(w, "%s%s struct {\n", strings.Repeat(" ", tab), elem.Name)
 		}
 		var currentOffset uintptr
 		for idx, field := range elem.NestedFields {
 			isValidCustomNameType := isValidCustomTypeName(field.StringType)
 
 			if field.IsStructure && !isValidCustomNameType {
-				testPrintStructure(field, tab+4)
+				fprintStructure(w, field, tab+4)
 				currentOffset += field.Size
 			} else {
 				str := fmt.Sprintf("[Size: %d, Align: %d, Offset: %d]", field.Size, field.Align, field.Offset)
+				if field.Unknown {
+					// The layout is guessed, see isSizeKnown
+					str = fmt.Sprintf("[Size: %d?, Align: %d?, Offset: %d]", field.Size, field.Align, field.Offset)
+				}
 				padding := field.Offset - currentOffset
 				if padding > 0 {
 					str = fmt.Sprintf("+%db %s", padding, str)
@@ -60,10 +75,22 @@ func testPrintStructure(elem *Structure, tab int) {
 						str = fmt.Sprintf("%s +%db", str, finalPadding)
 					}
 				}
-				fmt.Printf(infoFormat+"\n", field.Name, field.StringType, str)
+				fmt.Fprintf(w, infoFormat+"\n", field.Name, field.StringType, str)
 			}
 		}
 	}
 
-	fmt.Printf("%s}  [Size: %d, Align: %d, Offset: %d]\n", strings.Repeat(" ", tab), elem.Size, elem.Align, elem.Offset)
+	if elem.MetaData != nil && elem.MetaData.MaxSize > 0 {
+		fmt.Fprintf(w, "%s}  [Size: %d, Align: %d, Offset: %d, MaxSize: %d]\n", strings.Repeat(" ", tab), elem.Size, elem.Align, elem.Offset, elem.MetaData.MaxSize)
+		return
+	}
+	fmt.Fprintf(w, "%s}  [Size: %d, Align: %d, Offset: %d]\n", strings.Repeat(" ", tab), elem.Size, elem.Align, elem.Offset)
+}
+
+// fprintInstantiations prints the sizes of the observed instantiations of a generic structure to w,
+// below the structure itself.
+func fprintInstantiations(w io.Writer, structure *Structure) {
+	for _, inst := range structure.MetaData.Instantiations {
+		fmt.Fprintf(w, "%s%-15s %d(b) -> %d(b)\n", strings.Repeat(" ", 6), inst.Name, inst.BeforeSize, inst.AfterSize)
+	}
 }
@@ -1,126 +1,334 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
-	"strings"
+	"go/parser"
+	"go/token"
+	"sort"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
 )
 
 // ============= Render
 
-// renderStructure generates a string representation of an Structure structure.
-// It handles both top-level structures and nested fields, including their
-// documentation, tags, and comments. The function recursively processes
-// nested structures to create a complete representation.
-//
-// The function performs the following tasks:
-// - Checks if the element is a valid custom type or a structure
-// - Generates the struct definition with its name (for top-level structures)
-// - Iterates through all nested fields, rendering each one
-// - Includes field documentation, tags, and comments
-// - Handles both root-level and nested comments
+// decoratedFile is a Go file parsed into a decorated syntax tree, where comments are attached to the nodes
+// they belong to, so they travel with fields when the fields are reordered.
 //
-// Parameters:
-// - elem: Pointer to an Structure structure to be rendered
-//
-// Returns:
-// - A string containing the rendered structure
-func renderStructure(elem *Structure) string {
-	isValidCustomNameType := isValidCustomTypeName(elem.StringType)
-	if !elem.IsStructure || isValidCustomNameType {
-		return elem.StringType
-	}
-
-	var data strings.Builder
-	if elem.Root != nil {
-		data.WriteString(elem.Name)
+// Nodes are looked up by the positions of the corresponding nodes of the go/ast tree the structures
+// have been created from, which is parsed from the same data with a new file set.
+type decoratedFile struct {
+	file  *dst.File
+	specs map[token.Pos]*dst.TypeSpec
+	// decls are the declarations of the type specs
+	decls   map[*dst.TypeSpec]*dst.GenDecl
+	structs map[token.Pos]*dst.StructType
+	fields  map[token.Pos]*dst.Field
+}
 
-		// Render generic type params
-		if typeParams := elem.Root.TypeParams; typeParams != nil && len(typeParams.List) > 0 {
-			params := typeParams.List
-			data.WriteRune('[')
-			data.WriteString(renderTypeParameter(params[0]))
-			for _, p := range params[1:] {
-				data.WriteString(", ")
-				data.WriteString(renderTypeParameter(p))
+// decorateSource parses the Go source (with LF line endings) into a decorated syntax tree.
+func decorateSource(data []byte) (*decoratedFile, error) {
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, "", data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	dec := decorator.NewDecorator(fset)
+	file, err := dec.DecorateFile(astFile)
+	if err != nil {
+		return nil, err
+	}
+	decorated := &decoratedFile{
+		file:    file,
+		specs:   make(map[token.Pos]*dst.TypeSpec),
+		decls:   make(map[*dst.TypeSpec]*dst.GenDecl),
+		structs: make(map[token.Pos]*dst.StructType),
+		fields:  make(map[token.Pos]*dst.Field),
+	}
+	ast.Inspect(astFile, func(n ast.Node) bool {
+		switch typed := n.(type) {
+		case *ast.TypeSpec:
+			decorated.specs[typed.Pos()], _ = dec.Dst.Nodes[typed].(*dst.TypeSpec)
+		case *ast.StructType:
+			decorated.structs[typed.Pos()], _ = dec.Dst.Nodes[typed].(*dst.StructType)
+		case *ast.Field:
+			decorated.fields[typed.Pos()], _ = dec.Dst.Nodes[typed].(*dst.Field)
+		}
+		return true
+	})
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*dst.GenDecl); ok {
+			for _, spec := range genDecl.Specs {
+				if typeSpec, ok := spec.(*dst.TypeSpec); ok {
+					decorated.decls[typeSpec] = genDecl
+				}
 			}
-			data.WriteRune(']')
 		}
+	}
+	return decorated, nil
+}
 
-		// Don't add "type " here, as current structure may be inside a "type" block
-		data.WriteString(" struct {")
-	} else {
-		// Anonymous structs don't support type params
-		data.WriteString("struct {")
+// reorder reorders the fields of the structure in the decorated tree according to its nested fields,
+// including the fields of nested anonymous structures.
+//
+// Fields declared together ("a, b int") which stay adjacent are kept in one declaration. Otherwise they are split,
+// the doc and trailing comments stay with the first part, while the tag is kept on every part as it is part
+// of the type of each field.
+func (f *decoratedFile) reorder(elem *Structure) error {
+	structType, ok := elem.StructType.(*ast.StructType)
+	if !ok {
+		return nil
 	}
-	if len(elem.NestedFields) > 0 {
-		data.WriteRune('\n')
+	decoratedStruct := f.structs[structType.Pos()]
+	if decoratedStruct == nil {
+		return fmt.Errorf("cannot find structure %s in decorated tree", elem.Name)
 	}
-
-	for idx, field := range elem.NestedFields {
-		// Doc
-		if field.RootField != nil && field.RootField.Doc != nil && len(field.RootField.Doc.List) > 0 {
-			for _, comment := range field.RootField.Doc.List {
-				data.WriteString(comment.Text)
-				data.WriteRune('\n')
-			}
+	fields := make([]*dst.Field, 0, len(elem.NestedFields))
+	split := make(map[*dst.Field]bool)
+	var last, lastOriginal *dst.Field
+	for _, nested := range elem.NestedFields {
+		original := f.fields[nested.RootField.Pos()]
+		if original == nil {
+			return fmt.Errorf("cannot find field %s of structure %s in decorated tree", nested.Name, elem.Name)
 		}
-		if strings.HasPrefix(field.Name, "!") {
-			field.Name = ""
-		}
-		data.WriteString(fmt.Sprintf("%s %s ", field.Name, renderStructure(field)))
-		// Tag
-		if field.RootField != nil {
-			// Tags
-			if field.RootField.Tag != nil && len(field.RootField.Tag.Value) > 0 {
-				data.WriteString(fmt.Sprintf(" %s", field.RootField.Tag.Value))
+		field := original
+		if len(original.Names) > 1 {
+			if original == lastOriginal {
+				last.Names = append(last.Names, dst.NewIdent(nested.Name))
+				continue
 			}
-			// Comment
-			if field.RootField.Comment != nil && len(field.RootField.Comment.List) > 0 {
-				for _, comment := range field.RootField.Comment.List {
-					data.WriteString(fmt.Sprintf(" %s", comment.Text))
+			if !split[original] {
+				// All fields of the group share the same anonymous structure type, it is reordered once
+				if err := f.reorder(nested); err != nil {
+					return err
 				}
 			}
+			field = dst.Clone(original).(*dst.Field)
+			field.Names = []*dst.Ident{dst.NewIdent(nested.Name)}
+			if split[original] {
+				field.Decs.Start = nil
+				field.Decs.End = nil
+			}
+			split[original] = true
+		} else if err := f.reorder(nested); err != nil {
+			return err
 		}
-		if idx != len(elem.NestedFields) {
-			data.WriteRune('\n')
+		// Blank lines separated fields of the original order
+		field.Decs.Before = dst.NewLine
+		field.Decs.After = dst.NewLine
+		fields = append(fields, field)
+		last, lastOriginal = field, original
+	}
+	decoratedStruct.Fields.List = fields
+	return nil
+}
+
+// print prints the decorated tree as formatted Go source.
+func (f *decoratedFile) print() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := decorator.Fprint(&buf, f.file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderDecl prints the declaration of a top-level structure in isolation, starting at its name:
+// "type " is not included, as the structure may be inside a "type" block. The trailing comment is included.
+// Anonymous structures are printed as a bare struct type, without surrounding comments.
+func (f *decoratedFile) renderDecl(elem *Structure) ([]byte, error) {
+	if elem.Root == nil {
+		return f.renderStructType(elem)
+	}
+	spec := f.specs[elem.Root.Pos()]
+	if spec == nil {
+		return nil, fmt.Errorf("cannot find structure %s in decorated tree", elem.Name)
+	}
+	decl := &dst.GenDecl{Tok: token.TYPE}
+	if parent := f.decls[spec]; parent != nil && !parent.Lparen {
+		// The trailing comment of a single type spec belongs to its declaration
+		decl.Decs.End = parent.Decs.End
+	}
+	spec = dst.Clone(spec).(*dst.TypeSpec)
+	// Doc comments are not part of the replaced declaration
+	spec.Decs.Before = dst.None
+	spec.Decs.Start = nil
+	spec.Decs.After = dst.None
+	decl.Specs = []dst.Spec{spec}
+	return printIsolated(elem, decl, scopedFormatPrefix)
+}
+
+// renderStructType prints the struct type of an anonymous structure in isolation.
+func (f *decoratedFile) renderStructType(elem *Structure) ([]byte, error) {
+	structType := f.structs[elem.StructType.Pos()]
+	if structType == nil {
+		return nil, fmt.Errorf("cannot find structure %s in decorated tree", elem.Name)
+	}
+	structType = dst.Clone(structType).(*dst.StructType)
+	// Comments around the struct type are not part of the replaced text
+	structType.Decs.Before = dst.None
+	structType.Decs.Start = nil
+	structType.Decs.End = nil
+	structType.Decs.After = dst.None
+	decl := &dst.GenDecl{
+		Tok:   token.VAR,
+		Specs: []dst.Spec{&dst.ValueSpec{Names: []*dst.Ident{dst.NewIdent("_")}, Type: structType}},
+	}
+	return printIsolated(elem, decl, scopedAnonymousFormatPrefix)
+}
+
+// printIsolated prints the declaration in a file of its own and returns the text after the given file prefix.
+func printIsolated(elem *Structure, decl dst.Decl, prefix string) ([]byte, error) {
+	file := &dst.File{Name: dst.NewIdent("p"), Decls: []dst.Decl{decl}}
+	var buf bytes.Buffer
+	if err := decorator.Fprint(&buf, file); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte(prefix)) {
+		return nil, fmt.Errorf("unexpected declaration of structure %s: %q", elem.Name, buf.Bytes())
+	}
+	return bytes.TrimSuffix(buf.Bytes()[len(prefix):], []byte("\n")), nil
+}
+
+// renderTextStructures reorders the fields of the top-level structures of the file and stores their
+// declarations in MetaData.Data, to be spliced into the file (see scopedReplace).
+func renderTextStructures(file []byte, structures []*Structure) error {
+	decorated, err := decorateSource(normalizeLineEndings(file))
+	if err != nil {
+		return err
+	}
+	for _, structure := range structures {
+		if err := decorated.reorder(structure); err != nil {
+			return err
 		}
 	}
+	for _, structure := range structures {
+		data, err := decorated.renderDecl(structure)
+		if err != nil {
+			return err
+		}
+		structure.MetaData.Data = data
+	}
+	return nil
+}
 
-	data.WriteRune('}')
+// fieldTypes returns the types of the fields of all structures declared in the Go source, keyed by the path
+// of the field, e.g. "A.b" or "A#2.b" for the second structure named "A" in the file. Anonymous structures
+// outside of type declarations are keyed by their type.
+//
+// Types are compared regardless of field order: fields of all struct types are split ("a, b int")
+// and sorted before types are printed by getTypeString, since fields of nested structures may be reordered.
+func fieldTypes(data []byte) (map[string]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var structTypes []*ast.StructType
+	ast.Inspect(file, func(n ast.Node) bool {
+		if structType, ok := n.(*ast.StructType); ok {
+			structTypes = append(structTypes, structType)
+		}
+		return true
+	})
+	// Nested struct types are normalized first, as their text is part of the sort key of the parent
+	for i := len(structTypes) - 1; i >= 0; i-- {
+		normalizeStructType(structTypes[i])
+	}
 
-	// Comments
-	if elem.RootField != nil {
-		if elem.RootField.Comment != nil && len(elem.RootField.Comment.List) > 0 {
-			for _, comment := range elem.RootField.Comment.List {
-				data.WriteString(comment.Text)
+	result := make(map[string]string)
+	var walk func(prefix string, structType *ast.StructType)
+	walk = func(prefix string, structType *ast.StructType) {
+		for _, field := range structType.Fields.List {
+			name := createFieldNames(field)[0]
+			if name == "" {
+				name = "!" + getTypeString(field.Type)
 			}
-		}
-	} else if elem.Root != nil {
-		if elem.Root.Comment != nil && len(elem.Root.Comment.List) > 0 {
-			for _, comment := range elem.Root.Comment.List {
-				data.WriteString(comment.Text)
+			path := prefix + "." + name
+			if nested, ok := field.Type.(*ast.StructType); ok {
+				walk(path, nested)
+				continue
 			}
+			result[path] = getTypeString(field.Type)
 		}
 	}
-	return data.String()
+	seen := make(map[string]int)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch typed := n.(type) {
+		case *ast.TypeSpec:
+			structType, ok := typed.Type.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			seen[typed.Name.Name]++
+			prefix := typed.Name.Name
+			if seen[prefix] > 1 {
+				prefix = fmt.Sprintf("%s#%d", prefix, seen[prefix])
+			}
+			walk(prefix, structType)
+			return false
+		case *ast.StructType:
+			text := getTypeString(typed)
+			seen[text]++
+			result[fmt.Sprintf("%s#%d", text, seen[text])] = text
+			return false
+		}
+		return true
+	})
+	return result, nil
 }
 
-// renderTypeParameter renders the given type parameter as Go code.
-func renderTypeParameter(f *ast.Field) string {
-	names := make([]string, len(f.Names))
-	for i := 0; i < len(names); i++ {
-		names[i] = f.Names[i].Name
+// normalizeStructType splits the fields declared together and sorts the fields of the struct type.
+func normalizeStructType(structType *ast.StructType) {
+	fields := make([]*ast.Field, 0, len(structType.Fields.List))
+	for _, field := range structType.Fields.List {
+		if len(field.Names) <= 1 {
+			fields = append(fields, field)
+			continue
+		}
+		for _, name := range field.Names {
+			part := *field
+			part.Names = []*ast.Ident{name}
+			fields = append(fields, &part)
+		}
+	}
+	keys := make(map[*ast.Field]string, len(fields))
+	for _, field := range fields {
+		keys[field] = getStructTypeString(&ast.StructType{Fields: &ast.FieldList{List: []*ast.Field{field}}})
 	}
-	return fmt.Sprintf("%s %s", strings.Join(names, ", "), getTypeString(f.Type))
+	sort.SliceStable(fields, func(i, j int) bool {
+		return keys[fields[i]] < keys[fields[j]]
+	})
+	structType.Fields.List = fields
 }
 
-func renderTextStructures(structures []*Structure) {
-	for _, structure := range structures {
-		// Don't format code here - "renderStructure" generates a replacement for a part of target Go file,
-		// not a valid piece of Go code per-se.
-		//
-		// Code will be formatted afterwards.
-		structure.MetaData.Data = []byte(renderStructure(structure))
+// checkFieldTypes returns an error when a field of a structure has been lost, added or had its type text changed
+// by the rewrite, so a fix never changes the meaning of a structure.
+func checkFieldTypes(before, after []byte) error {
+	beforeTypes, err := fieldTypes(before)
+	if err != nil {
+		return err
+	}
+	afterTypes, err := fieldTypes(after)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(beforeTypes))
+	for path := range beforeTypes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		afterType, ok := afterTypes[path]
+		if !ok {
+			return fmt.Errorf("field %s is missing after rewrite", path)
+		}
+		if afterType != beforeTypes[path] {
+			return fmt.Errorf("type of field %s changed from %q to %q", path, beforeTypes[path], afterType)
+		}
+	}
+	if len(afterTypes) != len(beforeTypes) {
+		return fmt.Errorf("rewrite added %d fields", len(afterTypes)-len(beforeTypes))
 	}
+	return nil
 }
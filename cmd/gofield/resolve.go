@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// siblingPackage contains the declarations of the files of a package, see siblingFiles
+type siblingPackage struct {
+	// types contains the package-level type declarations by name
+	types map[string]*ast.TypeSpec
+	// files contains the parsed files by file name
+	files map[string]*ast.File
+}
+
+// siblingPackages caches the parsed packages, see siblingFiles
+var siblingPackages = map[string]*siblingPackage{}
+
+// readPackageFiles reads the Go files of a folder by file name, see siblingFiles.
+// Files are read from the working tree, or from a git revision by the "compare" command (see useRevisionFiles).
+var readPackageFiles = readFolderFiles
+
+// readFolderFiles reads the Go files of a folder of the working tree.
+func readFolderFiles(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		files[entry.Name()] = data
+	}
+	return files, nil
+}
+
+// typeSpecOf returns the declaration of the type the identifier refers to, nil for predeclared types,
+// types declared in other packages which aren't in the types file (see resolveTableTypes)
+// or identifiers which are not types.
+func typeSpecOf(ident *ast.Ident) *ast.TypeSpec {
+	if ident.Obj == nil || ident.Obj.Kind != ast.Typ {
+		return nil
+	}
+	spec, _ := ident.Obj.Decl.(*ast.TypeSpec)
+	return spec
+}
+
+// resolveSiblingTypes resolves the identifiers of the file which refer to types declared in the other files
+// of its package, so the sizes of defined types and aliases can be computed from their underlying types.
+// Types declared in the file itself are already resolved by the parser.
+func resolveSiblingTypes(path string, file *ast.File) {
+	if path == "" || len(file.Unresolved) == 0 {
+		return
+	}
+	resolveIdents(file.Unresolved, siblingFiles(path, file).types)
+}
+
+// resolveIdents resolves the identifiers which refer to the given types.
+func resolveIdents(idents []*ast.Ident, types map[string]*ast.TypeSpec) {
+	for _, ident := range idents {
+		if spec, ok := types[ident.Name]; ok && ident.Obj == nil {
+			ident.Obj = &ast.Object{Kind: ast.Typ, Name: ident.Name, Decl: spec}
+		}
+	}
+}
+
+// siblingFiles returns the package of the file at the path, parsed from the files in its folder (see readPackageFiles).
+// Test files are only included for test files, and files excluded by build constraints are skipped.
+// Files which cannot be read or parsed are skipped as well, their types are left unresolved.
+// The package includes a separately parsed copy of the file itself.
+func siblingFiles(path string, file *ast.File) *siblingPackage {
+	dir, pkgName, test := filepath.Dir(path), file.Name.Name, strings.HasSuffix(path, "_test.go")
+	key := dir + "\x00" + pkgName
+	if test {
+		key += "\x00test"
+	}
+	if pkg, ok := siblingPackages[key]; ok {
+		return pkg
+	}
+
+	pkg := &siblingPackage{
+		types: make(map[string]*ast.TypeSpec),
+		files: make(map[string]*ast.File),
+	}
+	siblingPackages[key] = pkg
+	sources, err := readPackageFiles(dir)
+	if err != nil {
+		return pkg
+	}
+	// Build constraints are matched against the read sources, which may not be the ones of the working tree
+	ctxt := build.Default
+	ctxt.OpenFile = func(path string) (io.ReadCloser, error) {
+		data, ok := sources[filepath.Base(path)]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	// The first declaration of a type wins, in the order of file names
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".go") || (!test && strings.HasSuffix(name, "_test.go")) {
+			continue
+		}
+		if match, err := ctxt.MatchFile(dir, name); err != nil || !match {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), sources[name], 0)
+		if err != nil || file.Name.Name != pkgName {
+			continue
+		}
+		pkg.files[name] = file
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				if _, ok := pkg.types[typeSpec.Name.Name]; !ok {
+					pkg.types[typeSpec.Name.Name] = typeSpec
+				}
+			}
+		}
+	}
+	// Underlying types may refer to types declared in other files
+	for name, file := range pkg.files {
+		resolveIdents(file.Unresolved, pkg.types)
+		resolveTableTypes(filepath.Join(dir, name), file)
+	}
+	return pkg
+}
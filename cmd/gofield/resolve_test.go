@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+// definedTypesSource declares structures with fields of defined types and aliases
+const definedTypesSource = `package models
+
+type Level uint8
+type ID int32
+type Alias = ID
+type Buf [6]byte
+type Handler func()
+type Names []string
+
+type Inner struct {
+	a int64
+	b bool
+}
+
+type Event struct {
+	level   Level
+	id      ID
+	alias   Alias
+	buf     Buf
+	handler Handler
+	names   Names
+	inner   Inner
+}
+`
+
+// TestDefinedTypes tests that defined types and aliases have the layout of their underlying types.
+func TestDefinedTypes(t *testing.T) {
+	type Inner struct {
+		a int64
+		b bool
+	}
+	type Event struct {
+		level   uint8
+		id      int32
+		alias   int32
+		buf     [6]byte
+		handler func()
+		names   []string
+		inner   Inner
+	}
+
+	structures, mapper, err := ParseStrings(definedTypesSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calculateStructures(structures, true)
+	event := mapper["Event"]
+	if event == nil {
+		t.Fatal("Expected Event to be parsed")
+	}
+	if event.Size != unsafe.Sizeof(Event{}) || event.Align != unsafe.Alignof(Event{}) {
+		t.Errorf("Event: size %d, align %d; want size %d, align %d",
+			event.Size, event.Align, unsafe.Sizeof(Event{}), unsafe.Alignof(Event{}))
+	}
+	offsets := []uintptr{
+		unsafe.Offsetof(Event{}.level),
+		unsafe.Offsetof(Event{}.id),
+		unsafe.Offsetof(Event{}.alias),
+		unsafe.Offsetof(Event{}.buf),
+		unsafe.Offsetof(Event{}.handler),
+		unsafe.Offsetof(Event{}.names),
+		unsafe.Offsetof(Event{}.inner),
+	}
+	for i, field := range event.NestedFields {
+		if field.Offset != offsets[i] {
+			t.Errorf("Event.%s: offset %d; want %d", field.Name, field.Offset, offsets[i])
+		}
+	}
+}
+
+// TestSiblingTypes tests that types declared in other files of the package are resolved.
+func TestSiblingTypes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"event.go": "package models\n\ntype Event struct {\n\ta bool\n\tb Count\n\tc bool\n}\n",
+		"count.go": "package models\n\ntype Count Small\n\ntype Small int16\n",
+		// Other packages and excluded files must not be used
+		"other.go":   "//go:build ignore\n\npackage models\n\ntype Small int64\n",
+		"foreign.go": "package other\n\ntype Count int64\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "event.go")
+	structures, _, err := parseData(path, []byte(files["event.go"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calculateStructures(structures, true)
+	if len(structures) != 1 {
+		t.Fatalf("Expected 1 structure, got %d", len(structures))
+	}
+	if count := structures[0].NestedFields[1]; count.Size != 2 || count.Align != 2 {
+		t.Errorf("Event.b: size %d, align %d; want size 2, align 2", count.Size, count.Align)
+	}
+	if structures[0].Size != 6 {
+		t.Errorf("Event: size %d; want 6", structures[0].Size)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// scopes computes the scope-qualified identities of declarations while a file is visited.
+//
+// The scope of a declaration is empty at package level, "f" in the body of function f, "T.m" in method m of T,
+// "f.func1" in the first function literal of f, and "f.block2" in the second nested block of f. Blocks are numbered
+// rather than located by position, so identities survive unrelated edits, e.g. baseline entries.
+// Functions declared several times in a file ("init", "_") are numbered from their second declaration: "init#2".
+type scopes struct {
+	// funcs contains the scopes of the visited functions, function literals and nested blocks
+	funcs map[ast.Node]string
+	// literals counts the function literals visited in each scope
+	literals map[string]int
+	// blocks counts the nested blocks visited in each scope
+	blocks map[string]int
+	// declared counts the declarations of each function name
+	declared map[string]int
+}
+
+// newScopes creates scopes for a file.
+func newScopes() *scopes {
+	return &scopes{
+		funcs:    make(map[ast.Node]string),
+		literals: make(map[string]int),
+		blocks:   make(map[string]int),
+		declared: make(map[string]int),
+	}
+}
+
+// visit records the scope of the function, function literal or nested block at the top of the stack of nodes.
+// Functions and blocks must be visited before the nodes they contain.
+func (s *scopes) visit(stack []ast.Node) {
+	switch typed := stack[len(stack)-1].(type) {
+	case *ast.FuncDecl:
+		name := typed.Name.Name
+		if typed.Recv != nil && len(typed.Recv.List) > 0 {
+			name = receiverTypeName(typed.Recv.List[0].Type) + "." + name
+		}
+		s.declared[name]++
+		if count := s.declared[name]; count > 1 {
+			name = fmt.Sprintf("%s#%d", name, count)
+		}
+		s.funcs[typed] = name
+	case *ast.FuncLit:
+		parent := s.scope(stack)
+		s.literals[parent]++
+		s.funcs[typed] = qualifyName(parent, fmt.Sprintf("func%d", s.literals[parent]))
+	case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+		if len(stack) > 1 && (isFuncBody(stack[len(stack)-2], typed) || isClausesBody(stack[len(stack)-2], typed)) {
+			return
+		}
+		parent := s.scope(stack)
+		s.blocks[parent]++
+		s.funcs[typed] = qualifyName(parent, fmt.Sprintf("block%d", s.blocks[parent]))
+	}
+}
+
+// scope returns the scope of the declaration at the top of the stack of nodes.
+func (s *scopes) scope(stack []ast.Node) string {
+	for i := len(stack) - 2; i >= 0; i-- {
+		switch typed := stack[i].(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			return s.funcs[typed]
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+			if scope, ok := s.funcs[typed]; ok {
+				return scope
+			}
+		}
+	}
+	return ""
+}
+
+// isFuncBody reports whether the block is the body of the function or function literal.
+func isFuncBody(parent ast.Node, block ast.Node) bool {
+	switch typed := parent.(type) {
+	case *ast.FuncDecl:
+		return typed.Body == block
+	case *ast.FuncLit:
+		return typed.Body == block
+	}
+	return false
+}
+
+// isClausesBody reports whether the block is the body of a switch or select statement, which only contains
+// clauses: declarations are scoped by the clauses.
+func isClausesBody(parent ast.Node, block ast.Node) bool {
+	switch typed := parent.(type) {
+	case *ast.SwitchStmt:
+		return typed.Body == block
+	case *ast.TypeSwitchStmt:
+		return typed.Body == block
+	case *ast.SelectStmt:
+		return typed.Body == block
+	}
+	return false
+}
+
+// receiverTypeName returns the name of the type of a method receiver, without pointer and type parameters.
+func receiverTypeName(expr ast.Expr) string {
+	name := strings.TrimPrefix(getTypeString(expr), "*")
+	if idx := strings.Index(name, "["); idx >= 0 {
+		name = name[:idx]
+	}
+	return name
+}
+
+// qualifyName returns the name qualified with the scope.
+func qualifyName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// scopeSource declares structures with the same name in different scopes
+const scopeSource = `package models
+
+type item struct {
+	a bool
+	b int64
+	c bool
+}
+
+func f() {
+	type item struct {
+		a bool
+		b int32
+		c bool
+	}
+	if true {
+		type item struct {
+			a bool
+			b int16
+			c bool
+		}
+	}
+	_ = func() {
+		type item struct{ a bool }
+	}
+}
+
+func (*Holder[T]) m() {
+	type item struct{ a bool }
+}
+`
+
+// TestScopedPaths tests that structures get scope-qualified identities.
+func TestScopedPaths(t *testing.T) {
+	structures, mapper, err := ParseStrings(scopeSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, structure := range structures {
+		paths = append(paths, structure.Path)
+		if mapper[structure.Path] != structure {
+			t.Errorf("Expected %s to be in the mapper", structure.Path)
+		}
+	}
+	expected := "item, f.item, f.block1.item, f.func1.item, Holder.m.item"
+	if strings.Join(paths, ", ") != expected {
+		t.Errorf("Unexpected paths %q; want %q", strings.Join(paths, ", "), expected)
+	}
+}
+
+// TestScopedFix tests that structures with the same name in different scopes are fixed independently.
+func TestScopedFix(t *testing.T) {
+	result, findings, err := processSource("models.go", []byte(scopeSource), fileProcessingOptions{out: io.Discard, fixMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 3 {
+		t.Errorf("Expected 3 findings, got %d", len(findings))
+	}
+	for _, fixed := range []string{"\tb int64\n\ta bool\n", "\t\tb int32\n\t\ta bool\n", "\t\t\tb int16\n\t\t\ta bool\n"} {
+		if !strings.Contains(string(result), fixed) {
+			t.Errorf("Expected %q in the result:\n%s", fixed, result)
+		}
+	}
+}
+
+// TestScopedRepeatedFuncs tests that local structures of functions declared several times get distinct identities.
+func TestScopedRepeatedFuncs(t *testing.T) {
+	source := `package models
+
+func init() {
+	type item struct {
+		a bool
+		b int64
+		c bool
+	}
+}
+
+func init() {
+	type item struct {
+		b int64
+		a bool
+	}
+}
+
+func _() {
+	type item struct{ a bool }
+}
+
+func _() {
+	type item struct{ a bool }
+}
+`
+	structures, mapper, err := ParseStrings(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, structure := range structures {
+		paths = append(paths, structure.Path)
+		if mapper[structure.Path] != structure {
+			t.Errorf("Expected %s to be in the mapper", structure.Path)
+		}
+	}
+	expected := "init.item, init#2.item, _.item, _#2.item"
+	if strings.Join(paths, ", ") != expected {
+		t.Errorf("Unexpected paths %q; want %q", strings.Join(paths, ", "), expected)
+	}
+
+	result, findings, err := processSource("models.go", []byte(source), fileProcessingOptions{out: io.Discard, fixMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].structure.Path != "init.item" {
+		t.Errorf("Expected one finding for init.item, got %d", len(findings))
+	}
+	if !strings.Contains(string(result), "func init() {\n\ttype item struct {\n\t\tb int64\n\t\ta bool\n\t\tc bool\n") {
+		t.Errorf("Expected the first init.item to be fixed:\n%s", result)
+	}
+}
+
+// TestScopedPathsStable tests that nested blocks are numbered, so identities don't depend on positions.
+func TestScopedPathsStable(t *testing.T) {
+	source := `package models
+
+func f(v any) {
+	{
+		type L struct{ a bool }
+	}
+	switch v.(type) {
+	case int:
+		type L struct{ a bool }
+	default:
+		type L struct{ a bool }
+	}
+}
+`
+	var paths []string
+	for _, src := range []string{source, strings.Replace(source, "func f", "// f is documented\nfunc f", 1)} {
+		structures, _, err := ParseStrings(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, structure := range structures {
+			names = append(names, structure.Path)
+		}
+		paths = append(paths, strings.Join(names, ", "))
+	}
+	expected := "f.block1.L, f.block2.L, f.block3.L"
+	for _, got := range paths {
+		if got != expected {
+			t.Errorf("Unexpected paths %q; want %q", got, expected)
+		}
+	}
+}
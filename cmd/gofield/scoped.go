@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+
+	textreplacer "github.com/t34-dev/go-text-replacer"
+)
+
+// scopedFormatPrefix turns a rendered structure declaration into a Go file which can be formatted in isolation
+const scopedFormatPrefix = "package p\n\ntype "
+
+// scopedAnonymousFormatPrefix turns a rendered anonymous struct type into a Go file
+// which can be formatted in isolation
+const scopedAnonymousFormatPrefix = "package p\n\nvar _ "
+
+// formatStructureDecl formats the rendered declaration of a structure in isolation, in a file starting
+// with the prefix. Lines after the first one are indented with the given indent, e.g. for structures
+// in "type (...)" blocks or functions.
+func formatStructureDecl(prefix string, data []byte, indent string) ([]byte, error) {
+	src := append([]byte(prefix), data...)
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(formatted, []byte(prefix)) {
+		return nil, fmt.Errorf("unexpected formatted declaration: %q", formatted)
+	}
+	decl := bytes.TrimSuffix(formatted[len(prefix):], []byte("\n"))
+	if indent == "" {
+		return decl, nil
+	}
+	lines := bytes.Split(decl, []byte("\n"))
+	for i := 1; i < len(lines); i++ {
+		if len(lines[i]) > 0 {
+			lines[i] = append([]byte(indent), lines[i]...)
+		}
+	}
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+// lineIndent returns the leading whitespace of the line containing the offset.
+func lineIndent(data []byte, offset int) string {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	line := data[start:offset]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+// originalOffset converts an offset in data with normalized line endings to the offset in the original data.
+func originalOffset(data []byte, offset int) int {
+	normalized := 0
+	for i := 0; i < len(data); i++ {
+		if normalized == offset {
+			return i
+		}
+		if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			// Dropped by normalizeLineEndings
+			continue
+		}
+		normalized++
+	}
+	return len(data)
+}
+
+// scopedReplace replaces the declarations of the structures with their rendered versions, each one formatted
+// in isolation, leaving the rest of the file byte-for-byte untouched, including its line endings.
+// The data must not start with a BOM.
+func scopedReplace(path string, fileData []byte, structures []*Structure, style textStyle) ([]byte, error) {
+	normalized := normalizeLineEndings(fileData)
+	blocks := make([]textreplacer.Block, 0, len(structures))
+	for _, elem := range structures {
+		start := elem.MetaData.StartPos - 1
+		end := elem.MetaData.EndPos - 1
+		prefix := scopedFormatPrefix
+		if elem.Root == nil {
+			prefix = scopedAnonymousFormatPrefix
+		}
+		decl, err := formatStructureDecl(prefix, elem.MetaData.Data, lineIndent(normalized, start))
+		if err != nil {
+			return nil, fmt.Errorf("cannot format structure %s: %w", elem.Name, err)
+		}
+		if style.crlf {
+			decl = bytes.ReplaceAll(decl, []byte("\n"), []byte("\r\n"))
+		}
+		blocks = append(blocks, textreplacer.Block{
+			Start: originalOffset(fileData, start),
+			End:   originalOffset(fileData, end),
+			Txt:   decl,
+		})
+	}
+	result, err := textreplacer.New(fileData).Enter(blocks)
+	if err != nil {
+		return nil, err
+	}
+	// Unlike format.Source, splicing doesn't check the result
+	if _, err := parser.ParseFile(token.NewFileSet(), path, result, parser.ParseComments); err != nil {
+		return nil, fmt.Errorf("invalid result: %w", err)
+	}
+	return result, nil
+}
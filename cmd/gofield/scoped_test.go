@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestScopedFormat tests that only rewritten structures are formatted.
+func TestScopedFormat(t *testing.T) {
+	// The file isn't gofmt-clean outside of the structures
+	source := "package models\n\nimport (\"fmt\")\n\nvar  x = fmt.Sprint( 1 )\n\ntype A struct {\n\ta bool\n\tb    int64 // b\n\tc bool\n} // A\n\ntype (\n\tB struct {\n\t\ta bool\n\n\t\tb int64\n\t\tc bool\n\t}\n\tC struct{ a bool }\n)\n"
+	expected := "package models\n\nimport (\"fmt\")\n\nvar  x = fmt.Sprint( 1 )\n\ntype A struct {\n\tb int64 // b\n\ta bool\n\tc bool\n} // A\n\ntype (\n\tB struct {\n\t\tb int64\n\t\ta bool\n\t\tc bool\n\t}\n\tC struct{ a bool }\n)\n"
+	crlf := func(s string) string {
+		return strings.ReplaceAll(s, "\n", "\r\n")
+	}
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"LF", source, expected},
+		{"CRLF", crlf(source), crlf(expected)},
+		{"Mixed", strings.Replace(source, "\n", "\r\n", 3), strings.Replace(expected, "\n", "\r\n", 3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := fileProcessingOptions{out: io.Discard, fixMode: true, scopedFormat: true}
+			result, _, err := processSource("models.go", []byte(tt.source), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("processSource() = %q; want %q", result, tt.expected)
+			}
+		})
+	}
+}
@@ -3,12 +3,18 @@ package main
 import (
 	"fmt"
 	"go/ast"
+	"go/types"
 	"unsafe"
 )
 
 // getTypeID generates a unique identifier for an AST expression.
 // This is used to detect recursive types and prevent infinite loops.
 func getTypeID(expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		// Type arguments are substituted into new nodes, instantiations are identified by their text
+		return fmt.Sprintf("%T:%s", expr, types.ExprString(expr))
+	}
 	return fmt.Sprintf("%T:%p", expr, expr)
 }
 
@@ -38,7 +44,7 @@ func getFieldSizeWithMap(field ast.Expr, seenTypes map[string]bool) uintptr {
 			return unsafe.Sizeof(int32(0))
 		case "int64", "uint64", "float64":
 			return unsafe.Sizeof(int64(0))
-		case "int", "uint":
+		case "int", "uint", "uintptr":
 			return unsafe.Sizeof(int(0))
 		case "string":
 			return unsafe.Sizeof("")
@@ -46,6 +52,21 @@ func getFieldSizeWithMap(field ast.Expr, seenTypes map[string]bool) uintptr {
 			return unsafe.Sizeof(complex64(0))
 		case "complex128":
 			return unsafe.Sizeof(complex128(0))
+		case "error", "any":
+			return unsafe.Sizeof(error(nil))
+		}
+		// Defined types and aliases have the size of their underlying types
+		if spec := typeSpecOf(t); spec != nil {
+			return getFieldSizeWithMap(spec.Type, seenTypes)
+		}
+		if isTypeParam(t) {
+			// Type parameters don't have a size before instantiation
+			return 0
+		}
+	case *ast.SelectorExpr:
+		// Types declared in other packages are only sized with the types file, see resolveTableTypes
+		if spec := typeSpecOf(t.Sel); spec != nil {
+			return getFieldSizeWithMap(spec.Type, seenTypes)
 		}
 	case *ast.StarExpr:
 		return unsafe.Sizeof(uintptr(0))
@@ -61,10 +82,11 @@ func getFieldSizeWithMap(field ast.Expr, seenTypes map[string]bool) uintptr {
 			return elemSize * uintptr(length) // Remove padding
 		}
 	case *ast.StructType:
-		var size, maxAlign uintptr
+		var size uintptr
+		maxAlign := uintptr(1)
 		for _, field := range t.Fields.List {
-			fieldSize := getFieldSizeWithMap(field.Type, seenTypes)
-			fieldAlign := getFieldAlign(field.Type)
+			fieldSize := getFieldSizeWithMap(field.Type, seenTypes) * uintptr(maxValue(len(field.Names), 1))
+			fieldAlign := getFieldAlignWithMap(field.Type, seenTypes)
 			size = align(size, fieldAlign) + fieldSize
 			if fieldAlign > maxAlign {
 				maxAlign = fieldAlign
@@ -76,14 +98,30 @@ func getFieldSizeWithMap(field ast.Expr, seenTypes map[string]bool) uintptr {
 	case *ast.ChanType:
 		return unsafe.Sizeof(make(chan int))
 	case *ast.InterfaceType:
-		return unsafe.Sizeof((*interface{})(nil))
+		return unsafe.Sizeof(any(nil))
+	case *ast.FuncType:
+		return unsafe.Sizeof(func() {})
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		// Instantiations of generic types have the size of the declared type with the type arguments
+		if spec, indices := instantiatedType(t); spec != nil {
+			return getFieldSizeWithMap(substituteTypeParams(spec.Type, typeArguments(spec, indices)), seenTypes)
+		}
 	}
 	return unsafe.Sizeof("")
 }
 
-// getFieldAlign determines the alignment requirement of a field.
-// It handles various types similar to getFieldSizeWithMap.
-func getFieldAlign(field ast.Expr) uintptr {
+// getFieldAlignWithMap determines the alignment requirement of a field.
+// It handles various types similar to getFieldSizeWithMap, including recursive types.
+func getFieldAlignWithMap(field ast.Expr, seenTypes map[string]bool) uintptr {
+	typeID := getTypeID(field)
+
+	if seenTypes[typeID] {
+		return unsafe.Alignof(uintptr(0))
+	}
+
+	seenTypes[typeID] = true
+	defer delete(seenTypes, typeID)
+
 	switch t := (field).(type) {
 	case *ast.Ident:
 		switch t.Name {
@@ -97,19 +135,38 @@ func getFieldAlign(field ast.Expr) uintptr {
 			return unsafe.Alignof(int32(0))
 		case "int64", "uint64", "float64":
 			return unsafe.Alignof(int64(0))
-		case "int", "uint":
+		case "int", "uint", "uintptr":
 			return unsafe.Alignof(0)
 		case "string":
 			return unsafe.Alignof("")
+		case "complex64":
+			return unsafe.Alignof(complex64(0))
+		case "complex128":
+			return unsafe.Alignof(complex128(0))
+		case "error", "any":
+			return unsafe.Alignof(error(nil))
+		}
+		if spec := typeSpecOf(t); spec != nil {
+			return getFieldAlignWithMap(spec.Type, seenTypes)
+		}
+		if isTypeParam(t) {
+			return 1
+		}
+	case *ast.SelectorExpr:
+		if spec := typeSpecOf(t.Sel); spec != nil {
+			return getFieldAlignWithMap(spec.Type, seenTypes)
 		}
 	case *ast.StarExpr:
 		return unsafe.Alignof(uintptr(0))
 	case *ast.ArrayType:
-		return getFieldAlign(t.Elt)
+		if t.Len == nil {
+			return unsafe.Alignof([]int{})
+		}
+		return getFieldAlignWithMap(t.Elt, seenTypes)
 	case *ast.StructType:
-		var maxAlign uintptr
+		maxAlign := uintptr(1)
 		for _, field := range t.Fields.List {
-			fieldAlign := getFieldAlign(field.Type)
+			fieldAlign := getFieldAlignWithMap(field.Type, seenTypes)
 			if fieldAlign > maxAlign {
 				maxAlign = fieldAlign
 			}
@@ -120,11 +177,71 @@ func getFieldAlign(field ast.Expr) uintptr {
 	case *ast.ChanType:
 		return unsafe.Alignof(make(chan int))
 	case *ast.InterfaceType:
-		return unsafe.Alignof((*interface{})(nil))
+		return unsafe.Alignof(any(nil))
+	case *ast.FuncType:
+		return unsafe.Alignof(func() {})
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		if spec, indices := instantiatedType(t); spec != nil {
+			return getFieldAlignWithMap(substituteTypeParams(spec.Type, typeArguments(spec, indices)), seenTypes)
+		}
 	}
 	return unsafe.Alignof("")
 }
 
+// isSizeKnownWithMap reports whether the size and alignment of a type are known, rather than guessed by
+// getFieldSizeWithMap and getFieldAlignWithMap, which fall back to the layout of a string e.g. for types
+// declared in other packages which aren't in the types file. Type parameters and arrays of non-literal length
+// have unknown sizes as well.
+func isSizeKnownWithMap(field ast.Expr, seenTypes map[string]bool) bool {
+	typeID := getTypeID(field)
+
+	if seenTypes[typeID] {
+		return true
+	}
+
+	seenTypes[typeID] = true
+	defer delete(seenTypes, typeID)
+
+	switch t := (field).(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "bool", "int8", "uint8", "byte", "int16", "uint16", "int32", "uint32", "float32", "rune",
+			"int64", "uint64", "float64", "int", "uint", "uintptr", "string", "complex64", "complex128", "error", "any":
+			return true
+		}
+		if spec := typeSpecOf(t); spec != nil {
+			return isSizeKnownWithMap(spec.Type, seenTypes)
+		}
+	case *ast.SelectorExpr:
+		if spec := typeSpecOf(t.Sel); spec != nil {
+			return isSizeKnownWithMap(spec.Type, seenTypes)
+		}
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.InterfaceType, *ast.FuncType:
+		// Interface literals have the layout of any, whatever their methods
+		return true
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return true
+		}
+		if _, ok := t.Len.(*ast.BasicLit); !ok {
+			return false
+		}
+		return isSizeKnownWithMap(t.Elt, seenTypes)
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if !isSizeKnownWithMap(field.Type, seenTypes) {
+				return false
+			}
+		}
+		return true
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		if spec, indices := instantiatedType(t); spec != nil {
+			return isSizeKnownWithMap(substituteTypeParams(spec.Type, typeArguments(spec, indices)), seenTypes)
+		}
+	}
+	return false
+}
+
 // align calculates the next aligned address given a size and an alignment.
 // This function is used to ensure proper alignment of fields within a structure.
 func align(size, align uintptr) uintptr {
@@ -136,3 +253,13 @@ func align(size, align uintptr) uintptr {
 func getFieldSize(field ast.Expr) uintptr {
 	return getFieldSizeWithMap(field, make(map[string]bool))
 }
+
+// getFieldAlign is a wrapper function that initializes a new map and calls getFieldAlignWithMap.
+func getFieldAlign(field ast.Expr) uintptr {
+	return getFieldAlignWithMap(field, make(map[string]bool))
+}
+
+// isSizeKnown is a wrapper function that initializes a new map and calls isSizeKnownWithMap.
+func isSizeKnown(field ast.Expr) bool {
+	return isSizeKnownWithMap(field, make(map[string]bool))
+}
@@ -72,6 +72,7 @@ func TestGetFieldSizeTypes(t *testing.T) {
 		{"uint16", &ast.Ident{Name: "uint16"}, unsafe.Sizeof(uint16(0))},
 		{"uint32", &ast.Ident{Name: "uint32"}, unsafe.Sizeof(uint32(0))},
 		{"uint64", &ast.Ident{Name: "uint64"}, unsafe.Sizeof(uint64(0))},
+		{"uintptr", &ast.Ident{Name: "uintptr"}, unsafe.Sizeof(uintptr(0))},
 		{"float32", &ast.Ident{Name: "float32"}, unsafe.Sizeof(float32(0))},
 		{"float64", &ast.Ident{Name: "float64"}, unsafe.Sizeof(float64(0))},
 		{"complex64", &ast.Ident{Name: "complex64"}, unsafe.Sizeof(complex64(0))},
@@ -81,7 +82,8 @@ func TestGetFieldSizeTypes(t *testing.T) {
 		{"array", &ast.ArrayType{Elt: &ast.Ident{Name: "int"}, Len: &ast.BasicLit{Kind: token.INT, Value: "5"}}, unsafe.Sizeof([5]int{})},
 		{"map", &ast.MapType{Key: &ast.Ident{Name: "string"}, Value: &ast.Ident{Name: "int"}}, unsafe.Sizeof(map[string]int{})},
 		{"chan", &ast.ChanType{Value: &ast.Ident{Name: "int"}}, unsafe.Sizeof(make(chan int))},
-		{"interface", &ast.InterfaceType{}, unsafe.Sizeof((*interface{})(nil))},
+		{"interface", &ast.InterfaceType{}, unsafe.Sizeof(any(nil))},
+		{"func", &ast.FuncType{Params: &ast.FieldList{}}, unsafe.Sizeof(func() {})},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// stdinName is the name of the source read from stdin used in reports when no filename is given
+const stdinName = "<standard input>"
+
+// stdinOptions is a set of options which define how the source read from stdin gets processed.
+type stdinOptions struct {
+	// filename is the path the source belongs to. It is used to look up ignore files and in diagnostics.
+	filename         string
+	includeGenerated bool
+}
+
+// processStdin reads Go source from in, optimizes its structures and writes the fixed source to out.
+//
+// The source is written unchanged when there is nothing to fix, when it is generated or when
+// the filename is excluded by .gitignore or .gofieldignore files.
+// Nothing is written to out when the source cannot be processed.
+func processStdin(in io.Reader, out io.Writer, stdinOpts stdinOptions, opts fileProcessingOptions) error {
+	name := stdinName
+	if stdinOpts.filename != "" {
+		name = stdinOpts.filename
+	}
+	fileData, err := io.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("%s: cannot read source: %w", name, err)
+	}
+
+	if isSkippedStdinSource(fileData, stdinOpts) {
+		_, err = out.Write(fileData)
+		return err
+	}
+
+	opts.fixMode = true
+	result, _, err := processSource(name, fileData, opts)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		result = fileData
+	}
+	_, err = out.Write(result)
+	return err
+}
+
+// isSkippedStdinSource checks if the source read from stdin must be passed through unchanged.
+func isSkippedStdinSource(fileData []byte, stdinOpts stdinOptions) bool {
+	if !stdinOpts.includeGenerated && isGeneratedSource(stdinOpts.filename, fileData) {
+		return true
+	}
+	if stdinOpts.filename == "" {
+		return false
+	}
+	absPath, err := filepath.Abs(stdinOpts.filename)
+	if err != nil {
+		return false
+	}
+	root := findIgnoreRoot(filepath.Dir(absPath))
+	return newIgnoreMatcher().isIgnored(root, absPath, false)
+}
+
+// runStdin runs the stdin/stdout filter mode and returns the exit code.
+//
+// The report is printed to stderr in view and debug modes only, so stdout contains nothing but the source.
+func runStdin(stdinOpts stdinOptions, opts fileProcessingOptions) int {
+	opts.out = io.Discard
+	if opts.viewMode || opts.debugMode {
+		opts.out = os.Stderr
+	}
+	if err := processStdin(os.Stdin, os.Stdout, stdinOpts, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeErrors
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestProcessStdin tests the stdin/stdout filter mode.
+func TestProcessStdin(t *testing.T) {
+	source := "package main\n\ntype TestStruct struct {\n\ta bool\n\tb int64\n\tc bool\n}\n"
+	expected := "package main\n\ntype TestStruct struct {\n\tb int64\n\ta bool\n\tc bool\n}\n"
+	opts := fileProcessingOptions{out: io.Discard}
+
+	var out bytes.Buffer
+	if err := processStdin(strings.NewReader(source), &out, stdinOptions{}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected {
+		t.Errorf("Unexpected fixed source.\nGot:\n%s\nWant:\n%s", out.String(), expected)
+	}
+
+	// Nothing to fix - the source is written unchanged
+	out.Reset()
+	if err := processStdin(strings.NewReader(expected), &out, stdinOptions{}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected {
+		t.Errorf("Expected unchanged source, got:\n%s", out.String())
+	}
+
+	// Generated source is passed through
+	generated := "// Code generated by tool. DO NOT EDIT.\n\n" + source
+	out.Reset()
+	if err := processStdin(strings.NewReader(generated), &out, stdinOptions{}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != generated {
+		t.Errorf("Expected generated source to be passed through, got:\n%s", out.String())
+	}
+
+	// Source of a file excluded by .gofieldignore is passed through
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".gofieldignore"), []byte("ignored.go\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	stdinOpts := stdinOptions{filename: filepath.Join(dir, "ignored.go")}
+	if err := processStdin(strings.NewReader(source), &out, stdinOpts, opts); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != source {
+		t.Errorf("Expected ignored source to be passed through, got:\n%s", out.String())
+	}
+
+	// Diagnostics use the filename and nothing is written
+	out.Reset()
+	stdinOpts = stdinOptions{filename: "pkg/broken.go"}
+	err := processStdin(strings.NewReader("package main\n\ntype Broken struct {"), &out, stdinOpts, opts)
+	if err == nil || !strings.Contains(err.Error(), "pkg/broken.go:3:") {
+		t.Errorf("Expected error with filename position, got: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no output on error, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// rewrite is the new content of a file computed in fix mode, written only when all files have been fixed
+type rewrite struct {
+	path string
+	data []byte
+}
+
+// renameFile renames a file, replaced in tests to simulate failures
+var renameFile = os.Rename
+
+// typeCheckRewrites type-checks the packages of the rewritten files and the packages which may import them
+// with their new contents, using an overlay, and returns the type errors which didn't exist before the rewrite,
+// e.g. unkeyed composite literals of reordered structures in other packages. Nothing is written to the disk.
+//
+// Rewritten files of a module are checked with all the packages of the module, see loadTypeErrors.
+func typeCheckRewrites(rewrites []rewrite) ([]string, error) {
+	// overlays contains the new contents of the files by module root, or by folder outside of modules
+	overlays := make(map[string]map[string][]byte)
+	for _, item := range rewrites {
+		absPath, err := filepath.Abs(item.path)
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Dir(absPath)
+		if root := findModuleRoot(dir); root != "" {
+			dir = root
+		}
+		if overlays[dir] == nil {
+			overlays[dir] = make(map[string][]byte)
+		}
+		overlays[dir][absPath] = item.data
+	}
+	dirs := make([]string, 0, len(overlays))
+	for dir := range overlays {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var newErrors []string
+	for _, dir := range dirs {
+		before, err := loadTypeErrors(dir, nil)
+		if err != nil {
+			return nil, err
+		}
+		after, err := loadTypeErrors(dir, overlays[dir])
+		if err != nil {
+			return nil, err
+		}
+		// Errors are compared by message, since positions change when fields are reordered
+		known := make(map[string]int, len(before))
+		for _, pkgErr := range before {
+			known[pkgErr.Msg]++
+		}
+		seen := make(map[string]bool)
+		for _, pkgErr := range after {
+			if known[pkgErr.Msg] > 0 {
+				known[pkgErr.Msg]--
+				continue
+			}
+			description := pkgErr.Error()
+			if !seen[description] {
+				// Test variants of a package report the same errors
+				seen[description] = true
+				newErrors = append(newErrors, description)
+			}
+		}
+	}
+	return newErrors, nil
+}
+
+// loadTypeErrors loads and type-checks the packages of the module rooted at the folder ("./..."), including tests,
+// with the overlay. Folders outside of modules are loaded as the list of their non-test files.
+func loadTypeErrors(dir string, overlay map[string][]byte) ([]packages.Error, error) {
+	patterns := []string{"./..."}
+	if findModuleRoot(dir) == "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		patterns = patterns[:0]
+		for _, file := range files {
+			if !strings.HasSuffix(file, "_test.go") {
+				patterns = append(patterns, file)
+			}
+		}
+	}
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps |
+			packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+		Dir:     dir,
+		Tests:   true,
+		Overlay: overlay,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load packages of '%s': %w", dir, err)
+	}
+	var pkgErrors []packages.Error
+	for _, pkg := range pkgs {
+		pkgErrors = append(pkgErrors, pkg.Errors...)
+	}
+	return pkgErrors, nil
+}
+
+// writeRewrites writes the new contents of all files. Contents are first written to temporary files
+// next to the targets, which are then renamed over them, so a file is never left half-written
+// and nothing is written when a temporary file cannot be created. When a file cannot be replaced,
+// the files already replaced are restored with their original contents.
+//
+// Symlinks are followed and the permissions of the files are preserved.
+func writeRewrites(rewrites []rewrite) error {
+	targets := make([]string, 0, len(rewrites))
+	modes := make([]os.FileMode, 0, len(rewrites))
+	tmpPaths := make([]string, 0, len(rewrites))
+	// originals contains the contents of the targets before the rewrite, nil for new files
+	originals := make([][]byte, 0, len(rewrites))
+	removeTmpFiles := func() {
+		for _, tmpPath := range tmpPaths {
+			_ = os.Remove(tmpPath)
+		}
+	}
+	for _, item := range rewrites {
+		target, mode := writeTarget(item.path)
+		original, err := os.ReadFile(target)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			removeTmpFiles()
+			return fmt.Errorf("cannot read file '%s': %w", item.path, err)
+		}
+		tmpPath, err := writeTempFile(target, item.data, mode)
+		if err != nil {
+			removeTmpFiles()
+			return fmt.Errorf("cannot write results to file '%s': %w", item.path, err)
+		}
+		targets = append(targets, target)
+		modes = append(modes, mode)
+		tmpPaths = append(tmpPaths, tmpPath)
+		originals = append(originals, original)
+	}
+	for i, item := range rewrites {
+		if err := renameFile(tmpPaths[i], targets[i]); err != nil {
+			removeTmpFiles()
+			err = fmt.Errorf("cannot replace file '%s': %w", item.path, err)
+			if restoreErr := restoreOriginals(targets[:i], modes[:i], originals[:i]); restoreErr != nil {
+				return fmt.Errorf("%w, %v", err, restoreErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreOriginals restores the original contents of replaced files, new files are removed.
+// Returns the files which cannot be restored.
+func restoreOriginals(targets []string, modes []os.FileMode, originals [][]byte) error {
+	var failed []string
+	for i, target := range targets {
+		var err error
+		if originals[i] == nil {
+			err = os.Remove(target)
+		} else {
+			var tmpPath string
+			if tmpPath, err = writeTempFile(target, originals[i], modes[i]); err == nil {
+				if err = renameFile(tmpPath, target); err != nil {
+					_ = os.Remove(tmpPath)
+				}
+			}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("'%s': %v", target, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("cannot restore original files: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// writeTarget returns the file to write for the path, following symlinks, and its permissions (0644 for new files).
+func writeTarget(path string) (string, os.FileMode) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path, 0644
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return target, 0644
+	}
+	return target, info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// writeTempFile writes the data to a temporary file in the folder of the path with the given permissions
+// and returns the temporary file path.
+func writeTempFile(path string, data []byte, mode os.FileMode) (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".gofield-*")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := file.Name()
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, mode)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return "", err
+	}
+	return tmpPath, nil
+}
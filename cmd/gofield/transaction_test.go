@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestTypeCheckRewrites tests that only type errors introduced by rewrites are reported.
+func TestTypeCheckRewrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "models.go")
+	source := "package models\n\ntype A struct {\n\ta bool\n\tb int64\n}\n\nvar _ = A{true, 1}\n\nvar _ int = \"known error\"\n"
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	typeErrors, err := typeCheckRewrites([]rewrite{{path: path, data: []byte(source)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(typeErrors) != 0 {
+		t.Errorf("Expected existing errors to be ignored, got %v", typeErrors)
+	}
+
+	reordered := strings.Replace(source, "\ta bool\n\tb int64\n", "\tb int64\n\ta bool\n", 1)
+	typeErrors, err = typeCheckRewrites([]rewrite{{path: path, data: []byte(reordered)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(typeErrors) != 2 || !strings.Contains(typeErrors[0], "models.go:8:") {
+		t.Errorf("Expected 2 errors for the unkeyed literal, got %v", typeErrors)
+	}
+}
+
+// TestTypeCheckRewritesImporters tests that packages importing the rewritten ones are type-checked as well.
+func TestTypeCheckRewritesImporters(t *testing.T) {
+	dir := t.TempDir()
+	source := "package a\n\ntype T struct {\n\tA bool\n\tB int64\n\tC bool\n}\n"
+	files := map[string]string{
+		"go.mod":   "module example.com/m\n\ngo 1.21\n",
+		"a/a.go":   source,
+		"b/b.go":   "package b\n\nimport \"example.com/m/a\"\n\nvar _ = a.T{true, 1, false}\n",
+		"c/c.go":   "package c\n\nvar _ int = \"known error\"\n",
+		"a/doc.go": "// Package a is rewritten\npackage a\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reordered := "package a\n\ntype T struct {\n\tB int64\n\tA bool\n\tC bool\n}\n"
+	typeErrors, err := typeCheckRewrites([]rewrite{{path: filepath.Join(dir, "a", "a.go"), data: []byte(reordered)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(typeErrors) == 0 || !strings.Contains(typeErrors[0], filepath.Join("b", "b.go")+":5:") {
+		t.Errorf("Expected errors for the unkeyed literal in package b, got %v", typeErrors)
+	}
+}
+
+// TestWriteRewrites tests that files are replaced and no temporary files are left.
+func TestWriteRewrites(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")}
+	for _, path := range paths {
+		if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := writeRewrites([]rewrite{{path: paths[0], data: []byte("new a")}, {path: paths[1], data: []byte("new b")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []string{"new a", "new b"} {
+		data, err := os.ReadFile(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("Unexpected content of %s: %q; want %q", paths[i], data, expected)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected no temporary files, got %d entries", len(entries))
+	}
+
+	// Nothing is written when a file cannot be written
+	err = writeRewrites([]rewrite{{path: paths[0], data: []byte("newer a")}, {path: filepath.Join(dir, "missing", "c.go"), data: []byte("c")}})
+	if err == nil {
+		t.Fatal("Expected an error for a missing folder")
+	}
+	if data, _ := os.ReadFile(paths[0]); string(data) != "new a" {
+		t.Errorf("Expected %s to be untouched, got %q", paths[0], data)
+	}
+}
+
+// TestWriteRewritesRestoresFiles tests that replaced files are restored when a later file cannot be replaced.
+func TestWriteRewritesRestoresFiles(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go"), filepath.Join(dir, "new.go")}
+	for _, path := range paths[:2] {
+		if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(rename func(string, string) error) { renameFile = rename }(renameFile)
+	renameFile = func(oldPath, newPath string) error {
+		if newPath == paths[1] {
+			return errors.New("simulated failure")
+		}
+		return os.Rename(oldPath, newPath)
+	}
+
+	err := writeRewrites([]rewrite{
+		{path: paths[2], data: []byte("new")},
+		{path: paths[0], data: []byte("new a")},
+		{path: paths[1], data: []byte("new b")},
+	})
+	if err == nil || !strings.Contains(err.Error(), "simulated failure") {
+		t.Fatalf("Expected the simulated failure, got %v", err)
+	}
+	for _, path := range paths[:2] {
+		if data, _ := os.ReadFile(path); string(data) != "old" {
+			t.Errorf("Expected %s to be restored, got %q", path, data)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected the new file and temporary files to be removed, got %d entries", len(entries))
+	}
+}
+
+// TestWriteRewritesPreservesFile tests that permissions are preserved and symlinks are followed.
+func TestWriteRewritesPreservesFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Permissions and symlinks are not supported on Windows")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.go")
+	link := filepath.Join(dir, "link.go")
+	if err := os.WriteFile(path, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeRewrites([]rewrite{{path: link, data: []byte("new")}}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected the symlink to be preserved")
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("Expected mode 0755, got %v", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("Expected the target of the symlink to be written, got %q", data)
+	}
+}
@@ -6,31 +6,46 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
-
-	textreplacer "github.com/t34-dev/go-text-replacer"
 )
 
 // MetaData represents the outcome of struct optimization
 type MetaData struct {
 	BeforeSize uintptr
 	AfterSize  uintptr
-	Data       []byte
-	StartPos   int
-	EndPos     int
+	// MaxSize is the size budget defined by the "//gofield:maxsize" directive, 0 if there is no budget
+	MaxSize  uintptr
+	Data     []byte
+	StartPos int
+	EndPos   int
+	// Instantiations contains the observed instantiations of generic structures, see collectInstantiations
+	Instantiations []*instantiation
+	// Identity is the identity of anonymous structures, empty for type declarations, see anonymousIdentity
+	Identity string
+	guesses
 }
 
 // Structure represents detailed information about a struct field or type
 type Structure struct {
-	Name         string
-	Path         string
-	Root         *ast.TypeSpec
-	RootField    *ast.Field
-	StructType   ast.Expr
-	StringType   string
-	IsStructure  bool
-	Size         uintptr
-	Align        uintptr
-	Offset       uintptr
+	Name string
+	// Path is the identity of the structure or field: the scope-qualified name of top-level structures,
+	// e.g. "f.item" for a type declared in function f, followed by field names for fields ("f.item/a")
+	Path string
+	// Scope is the scope top-level structures are declared in, empty at package level (see scopes)
+	Scope string
+	// TypeID is the identity of the type of a field: the scope-qualified name of types declared in the file,
+	// the type string otherwise
+	TypeID      string
+	Root        *ast.TypeSpec
+	RootField   *ast.Field
+	StructType  ast.Expr
+	StringType  string
+	IsStructure bool
+	Size        uintptr
+	Align       uintptr
+	Offset      uintptr
+	// Unknown is set when the size of the field is guessed (see isSizeKnown), or the size of one of the fields
+	// of the structure
+	Unknown      bool
 	NestedFields []*Structure
 	MetaData     *MetaData
 }
@@ -55,20 +70,70 @@ func parseData(path string, bytes []byte) ([]*Structure, map[string]*Structure,
 	// Normalize line endings to LF
 	bytes = normalizeLineEndings(bytes)
 
-	node, err := parser.ParseFile(token.NewFileSet(), path, bytes, parser.ParseComments)
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, path, bytes, parser.ParseComments)
 	if err != nil {
 		return nil, nil, errors.New(fmt.Sprintf("Failed to parseData source: %v", err))
 	}
+	resolveSiblingTypes(path, node)
+	resolveTableTypes(path, node)
+	unkeyed := unkeyedAnonymousTypes(node)
+	if path != "" {
+		for _, file := range siblingFiles(path, node).files {
+			for identity := range unkeyedAnonymousTypes(file) {
+				unkeyed[identity] = true
+			}
+		}
+	}
 
 	//var results []MetaData
 	var structures []*Structure
 	mapperItems := map[string]*Structure{}
 
+	// Type specs are always direct children of the last visited declaration
+	var genDecl *ast.GenDecl
+	var directiveErr error
+	// stack contains the ancestors of the visited node and the node itself
+	var stack []ast.Node
+	declScopes := newScopes()
+	// typeScopes contains the scopes of all type declarations, used to resolve the types of fields
+	typeScopes := make(map[*ast.TypeSpec]string)
+	// analyzed contains the struct types which are already part of an analyzed structure
+	analyzed := make(map[*ast.StructType]bool)
 	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		declScopes.visit(stack)
+		if decl, ok := n.(*ast.GenDecl); ok {
+			genDecl = decl
+			return true
+		}
+		if structType, ok := n.(*ast.StructType); ok && !analyzed[structType] {
+			// Anonymous structure outside of a type declaration: variable, literal, parameter, element type...
+			markAnalyzed(structType, analyzed)
+			if hasUnkeyedIdentity(structType, unkeyed) {
+				// Reordering fields would break the literal, or make the type differ from the one of the literal
+				return true
+			}
+			scope := declScopes.scope(stack)
+			item := createStructItemInfo(anonymousStructName(stack, scope, mapperItems), scope, structType, mapperItems)
+			item.MetaData = &MetaData{
+				StartPos: int(structType.Pos()),
+				EndPos:   int(structType.End()),
+				Identity: anonymousIdentity(structType),
+			}
+			structures = append(structures, item)
+			return true
+		}
 		typeSpec, ok := n.(*ast.TypeSpec)
 		if !ok {
 			return true
 		}
+		scope := declScopes.scope(stack)
+		typeScopes[typeSpec] = scope
 		_, ok = typeSpec.Type.(*ast.StructType)
 		if !ok {
 			return true
@@ -81,20 +146,46 @@ func parseData(path string, bytes []byte) ([]*Structure, map[string]*Structure,
 			plus += len(typeSpec.Comment.List[0].Text) + 1
 		}
 		endPos := int(typeSpec.Type.End()) + plus
+		maxSize, err := parseMaxSizeDirective(typeSpecDoc(genDecl, typeSpec))
+		if err != nil && directiveErr == nil {
+			position := fset.Position(typeSpec.Pos())
+			directiveErr = fmt.Errorf("%s: %w", position, err)
+		}
 		metaData := MetaData{
+			MaxSize:  maxSize,
 			StartPos: startPos,
 			EndPos:   endPos,
 		}
-		item := createTypeItemInfo(typeSpec, nil, mapperItems)
+		item := createTypeItemInfo(typeSpec, scope, mapperItems)
 		item.MetaData = &metaData
-		if item != nil {
-			structures = append(structures, item)
-		}
+		markAnalyzed(typeSpec.Type.(*ast.StructType), analyzed)
+		structures = append(structures, item)
 		return true
 	})
+	if directiveErr != nil {
+		return nil, nil, directiveErr
+	}
+	for _, item := range mapperItems {
+		resolveTypeID(item, typeScopes)
+	}
+	collectInstantiations(path, node, structures)
 	return structures, mapperItems, err
 }
 
+// resolveTypeID sets the type identity of a field whose type is declared in the file to its scope-qualified name,
+// so types with the same name declared in different scopes are told apart.
+func resolveTypeID(field *Structure, typeScopes map[*ast.TypeSpec]string) {
+	ident, ok := field.StructType.(*ast.Ident)
+	if !ok || ident.Obj == nil {
+		return
+	}
+	if typeSpec, ok := ident.Obj.Decl.(*ast.TypeSpec); ok {
+		if scope, ok := typeScopes[typeSpec]; ok {
+			field.TypeID = qualifyName(scope, ident.Name)
+		}
+	}
+}
+
 func createMapperItem(structure *Structure, mapperItems map[string]*Structure) map[string]*Structure {
 	mapperItems[structure.Path] = structure
 	if structure.IsStructure {
@@ -113,19 +204,17 @@ func createMapper(structures []*Structure) map[string]*Structure {
 	return mapper
 }
 
-// Replacer replaces the original struct definitions with optimized versions in the source code
-func Replacer(file []byte, structures []*Structure) ([]byte, error) {
-	// Normalize line endings to LF
-	file = normalizeLineEndings(file)
-
-	var blocks []textreplacer.Block
+// Rewriter reorders the fields of the structures in the source code according to their optimized order
+// and prints the whole file. Fields are reordered in a decorated syntax tree, so comments travel with them.
+func Rewriter(file []byte, structures []*Structure) ([]byte, error) {
+	decorated, err := decorateSource(normalizeLineEndings(file))
+	if err != nil {
+		return nil, err
+	}
 	for _, elem := range structures {
-		blocks = append(blocks, textreplacer.Block{
-			Start: elem.MetaData.StartPos - 1,
-			End:   elem.MetaData.EndPos - 1,
-			Txt:   elem.MetaData.Data,
-		})
+		if err := decorated.reorder(elem); err != nil {
+			return nil, err
+		}
 	}
-	replacer := textreplacer.New(file)
-	return replacer.Enter(blocks)
+	return decorated.print()
 }
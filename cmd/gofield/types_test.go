@@ -72,7 +72,6 @@ type TestStruct struct {
 	calculateStructures(results, true)
 	optimizeMapperStructures(mapperData)
 	calculateStructures(results, false)
-	renderTextStructures(results)
 
 	if results[0].Name != "TestStruct" {
 		t.Errorf("Expected struct name 'TestStruct', got '%s'", results[0].Name)
@@ -83,7 +82,7 @@ type TestStruct struct {
 		t.Errorf("Expected non-zero sizes, got before: %d, after: %d", results[0].MetaData.BeforeSize, results[0].MetaData.AfterSize)
 	}
 
-	replaced, err := Replacer([]byte(input), results)
+	replaced, err := Rewriter([]byte(input), results)
 	if err != nil {
 		t.Errorf("Cannot replace structs code: %v\n", err)
 	}
@@ -125,10 +124,10 @@ type TestStruct struct {
 	}
 }
 
-// TestReplacer tests the Replacer function.
+// TestRewriter tests the Rewriter function.
 // It checks if the function can replace the original struct definition
 // with an optimized version.
-func TestReplacer(t *testing.T) {
+func TestRewriter(t *testing.T) {
 	original := []byte(`package main
 
 type TestStruct struct {
@@ -144,11 +143,10 @@ type TestStruct struct {
 	calculateStructures(results, true)
 	optimizeMapperStructures(mapperData)
 	calculateStructures(results, false)
-	renderTextStructures(results)
 
-	modified, err := Replacer(original, results)
+	modified, err := Rewriter(original, results)
 	if err != nil {
-		t.Fatalf("Replacer failed: %v", err)
+		t.Fatalf("Rewriter failed: %v", err)
 	}
 
 	modified, err = format.Source(modified)
@@ -181,3 +179,102 @@ func TestParseFile(t *testing.T) {
 		t.Errorf("Expected error for non-existent file, got nil")
 	}
 }
+
+// TestRewriterComments tests that comments travel with reordered fields.
+func TestRewriterComments(t *testing.T) {
+	input := "package models\n\n// A is documented\ntype A struct {\n\t// a is a flag\n\ta bool /* block\n\tcomment */\n\n\tb, c int64 // shared\n\td    int32\n} /* trailing\nblock */\n"
+	expected := "package models\n\n// A is documented\ntype A struct {\n\tb, c int64 // shared\n\td    int32\n\t// a is a flag\n\ta bool /* block\n\tcomment */\n} /* trailing\nblock */\n"
+	for name, source := range map[string]string{"LF": input, "CRLF": strings.ReplaceAll(input, "\n", "\r\n")} {
+		t.Run(name, func(t *testing.T) {
+			results, mapperData, err := ParseStrings(source)
+			if err != nil {
+				t.Fatalf("ParseStrings failed: %v", err)
+			}
+			calculateStructures(results, true)
+			optimizeMapperStructures(mapperData)
+			calculateStructures(results, false)
+
+			modified, err := Rewriter([]byte(source), results)
+			if err != nil {
+				t.Fatalf("Rewriter failed: %v", err)
+			}
+			if string(modified) != expected {
+				t.Errorf("Rewriter() = %q; want %q", modified, expected)
+			}
+		})
+	}
+}
+
+// TestCheckFieldTypes tests that rewrites which lose, add or change fields are detected.
+func TestCheckFieldTypes(t *testing.T) {
+	source := "package models\n\ntype A struct {\n\ta bool\n\tc io.Closer\n\tb interface{ Close() error }\n\td []struct{ A int }\n\te struct {\n\t\tf bool\n\t\tg int64\n\t}\n}\n"
+	results, mapperData, err := ParseStrings(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calculateStructures(results, true)
+	optimizeMapperStructures(mapperData)
+	calculateStructures(results, false)
+	modified, err := Rewriter([]byte(source), results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFieldTypes([]byte(source), modified); err != nil {
+		t.Errorf("Expected field types to round-trip, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		modified string
+	}{
+		{"Changed type", strings.Replace(source, "interface{ Close() error }", "interface{}", 1)},
+		{"Changed nested type", strings.Replace(source, "f bool", "f int", 1)},
+		{"Missing field", strings.Replace(source, "\ta bool\n", "", 1)},
+		{"Added field", strings.Replace(source, "\ta bool\n", "\ta bool\n\tz bool\n", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkFieldTypes([]byte(source), []byte(tt.modified)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+// TestRewriterSplitFields tests that fields declared together are merged back when adjacent
+// and split without duplicating comments otherwise.
+func TestRewriterSplitFields(t *testing.T) {
+	input := "package models\n\ntype A struct {\n\t// ab is documented\n\ta, b bool `json:\"-\"` // ab\n\tc    int64\n}\n"
+	tests := []struct {
+		name     string
+		order    []string
+		expected string
+	}{
+		{"Adjacent", []string{"c", "b", "a"}, "package models\n\ntype A struct {\n\tc int64\n\t// ab is documented\n\tb, a bool `json:\"-\"` // ab\n}\n"},
+		{"Apart", []string{"a", "c", "b"}, "package models\n\ntype A struct {\n\t// ab is documented\n\ta bool `json:\"-\"` // ab\n\tc int64\n\tb bool `json:\"-\"`\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, _, err := ParseStrings(input)
+			if err != nil {
+				t.Fatalf("ParseStrings failed: %v", err)
+			}
+			byName := make(map[string]*Structure)
+			for _, field := range results[0].NestedFields {
+				byName[field.Name] = field
+			}
+			results[0].NestedFields = results[0].NestedFields[:0]
+			for _, name := range tt.order {
+				results[0].NestedFields = append(results[0].NestedFields, byName[name])
+			}
+
+			modified, err := Rewriter([]byte(input), results)
+			if err != nil {
+				t.Fatalf("Rewriter failed: %v", err)
+			}
+			if string(modified) != tt.expected {
+				t.Errorf("Rewriter() = %q; want %q", modified, tt.expected)
+			}
+		})
+	}
+}
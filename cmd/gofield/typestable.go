@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// typesFileVersion is the version of the types file format
+const typesFileVersion = 1
+
+// typesFileEntry is the layout of a type in a types file
+type typesFileEntry struct {
+	Size  uintptr `json:"size"`
+	Align uintptr `json:"align"`
+	// Pointers tells whether the type contains pointers, for information only
+	Pointers bool `json:"pointers,omitempty"`
+}
+
+// typesFile is the content of a types file: the layouts of types the program cannot size itself,
+// e.g. types declared in other packages, cgo types or types excluded by build constraints,
+// by fully qualified name ("github.com/google/uuid.UUID", "C.struct_foo")
+type typesFile struct {
+	Version int                       `json:"version"`
+	Types   map[string]typesFileEntry `json:"types"`
+}
+
+// tableTypes contains the declarations of the types of the loaded types file by fully qualified name, see useTypesFile
+var tableTypes = map[string]*ast.TypeSpec{}
+
+// majorVersion matches the major version suffix of an import path, e.g. "v2"
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// loadTypesFile reads a types file.
+func loadTypesFile(path string) (map[string]typesFileEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read types file: %w", err)
+	}
+	var file typesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("cannot parse types file: %w", err)
+	}
+	if file.Version != typesFileVersion {
+		return nil, fmt.Errorf("unsupported types file version %d", file.Version)
+	}
+	for name, entry := range file.Types {
+		if dot := strings.LastIndex(name, "."); dot <= 0 || dot == len(name)-1 {
+			return nil, fmt.Errorf("type %q: expected a fully qualified name, e.g. \"github.com/google/uuid.UUID\"", name)
+		}
+		switch entry.Align {
+		case 1, 2, 4, 8:
+		default:
+			return nil, fmt.Errorf("type %q: alignment %d is not 1, 2, 4 or 8", name, entry.Align)
+		}
+		if entry.Size%entry.Align != 0 {
+			return nil, fmt.Errorf("type %q: size %d is not a multiple of alignment %d", name, entry.Size, entry.Align)
+		}
+	}
+	return file.Types, nil
+}
+
+// useTypesFile loads the types file at the path, so the types it declares are sized with their given layouts
+// ahead of any fallback. Nothing is loaded for an empty path.
+func useTypesFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	entries, err := loadTypesFile(path)
+	if err != nil {
+		return err
+	}
+	tableTypes = make(map[string]*ast.TypeSpec, len(entries))
+	for name, entry := range entries {
+		tableTypes[name] = tableTypeSpec(name, entry)
+	}
+	return nil
+}
+
+// tableTypeSpec returns a declaration of a type with the layout of the entry: an empty array of an unsigned integer
+// of the alignment followed by an array of bytes of the size, e.g. "struct{ _ [0]uint64; _ [24]byte }",
+// so the type is sized through its declaration like the types declared in the package, see typeSpecOf.
+func tableTypeSpec(name string, entry typesFileEntry) *ast.TypeSpec {
+	src := fmt.Sprintf("struct{ _ [0]uint%d; _ [%d]byte }", entry.Align*8, entry.Size)
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		panic(fmt.Sprintf("cannot parse %q: %v", src, err))
+	}
+	return &ast.TypeSpec{Name: ast.NewIdent(name[strings.LastIndex(name, ".")+1:]), Type: expr}
+}
+
+// resolveTableTypes resolves the identifiers of the file which refer to types of the types file: qualified identifiers
+// of imported packages, e.g. "uuid.UUID" or "C.struct_foo", and identifiers of types of the package of the file
+// which aren't declared in the parsed files, e.g. types excluded by build constraints.
+// The path is empty for sources which aren't files, only qualified identifiers are resolved then.
+func resolveTableTypes(filePath string, file *ast.File) {
+	if len(tableTypes) == 0 {
+		return
+	}
+
+	imports := make(map[string]string, len(file.Imports))
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := importName(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = importPath
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		selector, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := selector.X.(*ast.Ident); ok && x.Obj == nil && selector.Sel.Obj == nil {
+			if importPath, ok := imports[x.Name]; ok {
+				resolveTableType(selector.Sel, importPath)
+			}
+		}
+		return true
+	})
+
+	if filePath == "" || len(file.Unresolved) == 0 {
+		return
+	}
+	pkgPath := folderImportPath(filePath)
+	if strings.HasSuffix(file.Name.Name, "_test") {
+		pkgPath += "_test"
+	}
+	for _, ident := range file.Unresolved {
+		if ident.Obj == nil {
+			resolveTableType(ident, pkgPath)
+		}
+	}
+}
+
+// resolveTableType resolves the identifier if the types file contains the type of this name in the package.
+func resolveTableType(ident *ast.Ident, pkgPath string) {
+	if spec, ok := tableTypes[pkgPath+"."+ident.Name]; ok {
+		ident.Obj = &ast.Object{Kind: ast.Typ, Name: ident.Name, Decl: spec}
+	}
+}
+
+// importName returns the default name of an imported package: the last element of its import path,
+// without major version suffix ("github.com/jackc/pgx/v5") or gopkg.in version ("gopkg.in/yaml.v3").
+func importName(importPath string) string {
+	name := path.Base(importPath)
+	if majorVersion.MatchString(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	if strings.HasPrefix(importPath, "gopkg.in/") {
+		if dot := strings.Index(name, ".v"); dot > 0 {
+			name = name[:dot]
+		}
+	}
+	return name
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"go/ast"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tableSource declares a structure with fields of types which are only sized with a types file
+const tableSource = `package models
+
+import "C"
+import "github.com/google/uuid"
+
+type Record struct {
+	ok  bool
+	id  uuid.UUID
+	foo C.struct_foo
+	g   Gated
+	n   int64
+}
+`
+
+// writeTypesFile writes a types file with the given content in a temporary folder and returns its path.
+func writeTypesFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "types.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestTypesFile tests that types of the types file are sized with their given layouts.
+func TestTypesFile(t *testing.T) {
+	t.Cleanup(func() { tableTypes = map[string]*ast.TypeSpec{} })
+	dir := t.TempDir()
+	path := filepath.Join(dir, "record.go")
+	if err := os.WriteFile(path, []byte(tableSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Gated is declared in a file excluded by build constraints
+	types := `{"version": 1, "types": {
+		"github.com/google/uuid.UUID": {"size": 16, "align": 1},
+		"C.struct_foo": {"size": 24, "align": 8, "pointers": true},
+		"` + filepath.ToSlash(dir) + `.Gated": {"size": 4, "align": 4}
+	}}`
+	if err := useTypesFile(writeTypesFile(t, types)); err != nil {
+		t.Fatal(err)
+	}
+
+	structures, mapper, err := parseData(path, []byte(tableSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calculateStructures(structures, true)
+	record := mapper["Record"]
+	offsets := []uintptr{0, 1, 24, 48, 56}
+	for i, field := range record.NestedFields {
+		if field.Offset != offsets[i] || field.Unknown {
+			t.Errorf("%s: offset %d, unknown %v; want offset %d, known", field.Name, field.Offset, field.Unknown, offsets[i])
+		}
+	}
+	if record.Size != 64 {
+		t.Errorf("Record: size %d; want 64", record.Size)
+	}
+
+	optimizeMapperStructures(mapper)
+	calculateStructures(structures, false)
+	if order := fieldOrder(record); order != "foo, n, g, id, ok" {
+		t.Errorf("Unexpected order %q; want %q", order, "foo, n, g, id, ok")
+	}
+	if record.MetaData.BeforeSize != 64 || record.MetaData.AfterSize != 56 {
+		t.Errorf("Record: %d(b) -> %d(b); want 64(b) -> 56(b)", record.MetaData.BeforeSize, record.MetaData.AfterSize)
+	}
+	if note := partialString(record); note != "" {
+		t.Errorf("partialString() = %q; want fully analyzed", note)
+	}
+}
+
+// TestLoadTypesFileErrors tests that invalid types files are rejected.
+func TestLoadTypesFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"json", `{`, "cannot parse types file"},
+		{"version", `{"version": 2, "types": {}}`, "unsupported types file version 2"},
+		{"name", `{"version": 1, "types": {"UUID": {"size": 16, "align": 1}}}`, "expected a fully qualified name"},
+		{"align", `{"version": 1, "types": {"a.T": {"size": 6, "align": 3}}}`, "alignment 3 is not 1, 2, 4 or 8"},
+		{"size", `{"version": 1, "types": {"a.T": {"size": 6, "align": 4}}}`, "size 6 is not a multiple of alignment 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadTypesFile(writeTypesFile(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadTypesFile() error = %v; want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestImportName tests the default names of imported packages.
+func TestImportName(t *testing.T) {
+	tests := map[string]string{
+		"C":                           "C",
+		"time":                        "time",
+		"github.com/google/uuid":      "uuid",
+		"github.com/jackc/pgx/v5":     "pgx",
+		"gopkg.in/yaml.v3":            "yaml",
+		"github.com/t34-dev/go-field": "go-field",
+	}
+	for importPath, want := range tests {
+		if got := importName(importPath); got != want {
+			t.Errorf("importName(%q) = %q; want %q", importPath, got, want)
+		}
+	}
+}
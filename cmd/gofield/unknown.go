@@ -0,0 +1,180 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// maxUnknownTypes bounds the number of distinct types of unknown size whose possible layouts are enumerated,
+// savings of structures with more of them are never reported
+const maxUnknownTypes = 3
+
+// possibleLayouts contains the sizes and alignments a type of unknown size may have, as far as padding is concerned.
+// Offsets are aligned to at most 8 bytes, so adding 8 bytes to the size of a field shifts the following fields
+// without changing their padding: sizes are only considered up to 8 bytes.
+var possibleLayouts = func() [][2]uintptr {
+	var layouts [][2]uintptr
+	for alignment := uintptr(1); alignment <= 8; alignment *= 2 {
+		for size := alignment; size <= 8; size += alignment {
+			layouts = append(layouts, [2]uintptr{size, alignment})
+		}
+	}
+	return layouts
+}()
+
+// guesses tracks the types of unknown size of a structure or an instantiation, see isSizeKnown
+type guesses struct {
+	// UnknownTypes contains the types of unknown size, sorted
+	UnknownTypes []string
+	// before contains the sizes before optimization for every combination of possible layouts of the types,
+	// see guessedSizes
+	before []uintptr
+}
+
+// declaredType returns the declared type of a field.
+func declaredType(field *Structure) ast.Expr {
+	return field.StructType
+}
+
+// init records the types of unknown size of the fields and their sizes before optimization.
+// typeOf returns the type of a field which isn't a nested structure.
+func (g *guesses) init(fields []*Structure, typeOf func(field *Structure) ast.Expr) {
+	g.UnknownTypes = unknownTypes(fields, typeOf)
+	g.before = nil
+	if len(g.UnknownTypes) > 0 {
+		g.before = guessedSizes(fields, g.UnknownTypes, typeOf)
+	}
+}
+
+// afterSize returns the size after optimization to report, given the sizes before and after optimization computed
+// with guessed sizes: only the bytes freed whatever the sizes of the types of unknown size are reported.
+func (g *guesses) afterSize(before, after uintptr, fields []*Structure, typeOf func(field *Structure) ast.Expr) uintptr {
+	if len(g.UnknownTypes) == 0 {
+		return after
+	}
+	saving := int(before) - int(after)
+	if g.before == nil {
+		// Too many types of unknown size
+		saving = 0
+	}
+	for i, size := range guessedSizes(fields, g.UnknownTypes, typeOf) {
+		if guessed := int(g.before[i]) - int(size); guessed < saving {
+			saving = guessed
+		}
+	}
+	if saving < 0 {
+		return before
+	}
+	return before - uintptr(saving)
+}
+
+// unknownTypes returns the distinct types of unknown size of the fields and their nested structures, sorted.
+// typeOf returns the type of a field which isn't a nested structure.
+func unknownTypes(fields []*Structure, typeOf func(field *Structure) ast.Expr) []string {
+	found := make(map[string]bool)
+	var visit func(fields []*Structure)
+	visit = func(fields []*Structure) {
+		for _, field := range fields {
+			if field.IsStructure {
+				visit(field.NestedFields)
+			} else if expr := typeOf(field); !isSizeKnown(expr) {
+				found[types.ExprString(expr)] = true
+			}
+		}
+	}
+	visit(fields)
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// guessedSizes returns the sizes of the fields in their current order for every combination of possible layouts
+// of the types of unknown size (see possibleLayouts), nil if there are more than maxUnknownTypes of them.
+// typeOf returns the type of a field which isn't a nested structure.
+func guessedSizes(fields []*Structure, unknown []string, typeOf func(field *Structure) ast.Expr) []uintptr {
+	if len(unknown) > maxUnknownTypes {
+		return nil
+	}
+	indexes := make(map[string]int, len(unknown))
+	for i, name := range unknown {
+		indexes[name] = i
+	}
+
+	// leafLayout is the layout of a field which isn't a nested structure, index is -1 for known sizes
+	type leafLayout struct {
+		index           int
+		size, alignment uintptr
+	}
+	leaves := make(map[*Structure]leafLayout)
+	var visit func(fields []*Structure)
+	visit = func(fields []*Structure) {
+		for _, field := range fields {
+			if field.IsStructure {
+				visit(field.NestedFields)
+				continue
+			}
+			expr := typeOf(field)
+			if index, ok := indexes[types.ExprString(expr)]; ok && !isSizeKnown(expr) {
+				leaves[field] = leafLayout{index: index}
+			} else {
+				leaves[field] = leafLayout{index: -1, size: getFieldSize(expr), alignment: getFieldAlign(expr)}
+			}
+		}
+	}
+	visit(fields)
+
+	combinations := 1
+	for range unknown {
+		combinations *= len(possibleLayouts)
+	}
+	sizes := make([]uintptr, combinations)
+	layouts := make([][2]uintptr, len(unknown))
+	for combination := range sizes {
+		n := combination
+		for i := range layouts {
+			layouts[i] = possibleLayouts[n%len(possibleLayouts)]
+			n /= len(possibleLayouts)
+		}
+		sizes[combination], _ = layoutFields(fields, func(field *Structure) (uintptr, uintptr) {
+			leaf := leaves[field]
+			if leaf.index < 0 {
+				return leaf.size, leaf.alignment
+			}
+			return layouts[leaf.index][0], layouts[leaf.index][1]
+		})
+	}
+	return sizes
+}
+
+// hasUnknownSize reports whether the size of the field or of one of the fields of a nested structure is unknown.
+// typeOf returns the type of a field which isn't a nested structure.
+func hasUnknownSize(field *Structure, typeOf func(field *Structure) ast.Expr) bool {
+	if !field.IsStructure {
+		return !isSizeKnown(typeOf(field))
+	}
+	for _, nested := range field.NestedFields {
+		if hasUnknownSize(nested, typeOf) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnknown reports whether the size of the field is guessed, see calculateStructure.
+func isUnknown(field *Structure) bool {
+	return field.Unknown
+}
+
+// partialString returns the note about the types of unknown size of a partially analyzed structure,
+// empty if the structure is fully analyzed.
+func partialString(structure *Structure) string {
+	if structure.MetaData == nil || len(structure.MetaData.UnknownTypes) == 0 {
+		return ""
+	}
+	return " [partially analyzed, unknown sizes: " + strings.Join(structure.MetaData.UnknownTypes, ", ") + "]"
+}
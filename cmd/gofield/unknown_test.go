@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestIsSizeKnown tests which types have known sizes.
+func TestIsSizeKnown(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"int64", true},
+		{"error", true},
+		{"*time.Time", true},
+		{"[]time.Time", true},
+		{"map[string]time.Time", true},
+		{"func(time.Time)", true},
+		{"interface{ Close() error }", true},
+		{"[4]int32", true},
+		{"struct{ a, b int }", true},
+		{"time.Time", false},
+		{"Unresolved", false},
+		{"[4]time.Time", false},
+		{"[N]int", false},
+		{"struct{ a int; t time.Time }", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			if got := isSizeKnown(mustParseExpr(t, tt.src)); got != tt.want {
+				t.Errorf("isSizeKnown(%s) = %v; want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// unknownSource declares structures with fields of types declared in other packages
+const unknownSource = `package models
+
+import "time"
+
+type Tail struct {
+	a  bool
+	n  int64
+	b  bool
+	c  int64
+	d  bool
+	at time.Time
+}
+
+type Head struct {
+	at time.Time
+	a  bool
+	n  int64
+	b  bool
+}
+
+type Nested struct {
+	a     bool
+	inner struct {
+		d time.Duration
+		b bool
+	}
+	n int64
+	b bool
+}
+`
+
+// TestUnknownSizes tests that fields of unknown size are left in place and savings are only reported
+// when they don't depend on guessed sizes.
+func TestUnknownSizes(t *testing.T) {
+	mapper := optimizeSource(t, unknownSource)
+
+	tests := []struct {
+		name   string
+		order  string
+		saving uintptr
+		note   string
+	}{
+		// Frees 8 bytes whatever the size of time.Time
+		{"Tail", "n, c, a, b, d, at", 8, " [partially analyzed, unknown sizes: time.Time]"},
+		// Frees 8 bytes if time.Time is aligned to 8 bytes, nothing if it is a [7]byte
+		{"Head", "at, n, a, b", 0, " [partially analyzed, unknown sizes: time.Time]"},
+		{"Nested", "n, inner, a, b", 0, " [partially analyzed, unknown sizes: time.Duration]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			structure := mapper[tt.name]
+			if order := fieldOrder(structure); order != tt.order {
+				t.Errorf("Unexpected order %q; want %q", order, tt.order)
+			}
+			if saving := structure.MetaData.BeforeSize - structure.MetaData.AfterSize; saving != tt.saving {
+				t.Errorf("Unexpected saving %d(b); want %d(b)", saving, tt.saving)
+			}
+			if note := partialString(structure); note != tt.note {
+				t.Errorf("partialString() = %q; want %q", note, tt.note)
+			}
+		})
+	}
+}
+
+// TestGuaranteedSavingTooManyTypes tests that no savings are reported with too many types of unknown size.
+func TestGuaranteedSavingTooManyTypes(t *testing.T) {
+	mapper := optimizeSource(t, `package models
+
+type Many struct {
+	a bool
+	n int64
+	b bool
+	c int64
+	d bool
+	w a.W
+	x a.X
+	y a.Y
+	z a.Z
+}
+`)
+	many := mapper["Many"]
+	if many.MetaData.BeforeSize != many.MetaData.AfterSize {
+		t.Errorf("Many: %d(b) -> %d(b); want no saving", many.MetaData.BeforeSize, many.MetaData.AfterSize)
+	}
+}
+
+// interfaceSource declares structures with fields of interface literals and predeclared interfaces
+const interfaceSource = `package models
+
+type B struct {
+	x bool
+	y interface{}
+	z int64
+}
+
+type C struct {
+	a bool
+	c interface{ Close() error }
+	e error
+	y any
+	z int32
+}
+`
+
+// TestInterfaceLayouts tests that interface literals have known layouts, matching the compiler's ones.
+func TestInterfaceLayouts(t *testing.T) {
+	mapper := optimizeSource(t, interfaceSource)
+	if c := mapper["C"]; c.MetaData.BeforeSize != 64 || c.MetaData.AfterSize != 56 || partialString(c) != "" {
+		t.Errorf("C: %d(b) -> %d(b)%s; want 64(b) -> 56(b), fully analyzed", c.MetaData.BeforeSize, c.MetaData.AfterSize, partialString(c))
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":    "module example.com/verify\n\ngo 1.21\n",
+		"models.go": interfaceSource,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if code := runVerify([]string{"--files", dir}); code != 0 {
+		t.Errorf("Expected layouts matching the compiler, got exit code %d", code)
+	}
+}
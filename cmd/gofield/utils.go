@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"go/ast"
+	"go/types"
 	"sort"
 	"strings"
 	"unicode"
@@ -58,9 +59,7 @@ func getTypeString(expr ast.Expr) string {
 	case *ast.ChanType:
 		return getChanTypeString(t)
 	case *ast.StructType:
-		return "struct{}"
-	case *ast.InterfaceType:
-		return "interface{}"
+		return getStructTypeString(t)
 	case *ast.Ellipsis:
 		return "..." + getTypeString(t.Elt)
 	case *ast.ParenExpr:
@@ -80,13 +79,30 @@ func getTypeString(expr ast.Expr) string {
 		}
 		return fmt.Sprintf("%s[%s]", getTypeString(t.X), strings.Join(idxTypes, ", "))
 	default:
-		// TODO: maybe, it's better to fail here?
-		//
-		// It'll be easier to add support of what we've missed.
-		return fmt.Sprintf("%T", expr)
+		// Interfaces, constraints ("~int | ~string") and anything else
+		return types.ExprString(expr)
 	}
 }
 
+// getStructTypeString returns a one-line string representation of a struct type, including tags
+func getStructTypeString(t *ast.StructType) string {
+	if t.Fields == nil || len(t.Fields.List) == 0 {
+		return "struct{}"
+	}
+	parts := make([]string, 0, len(t.Fields.List))
+	for _, field := range t.Fields.List {
+		part := getTypeString(field.Type)
+		if len(field.Names) > 0 {
+			part = strings.Join(createFieldNames(field), ", ") + " " + part
+		}
+		if field.Tag != nil {
+			part += " " + field.Tag.Value
+		}
+		parts = append(parts, part)
+	}
+	return "struct{" + strings.Join(parts, "; ") + "}"
+}
+
 // getFuncTypeString returns a string representation of a function type
 func getFuncTypeString(t *ast.FuncType) string {
 	params := getFieldListString(t.Params)
@@ -95,6 +111,9 @@ func getFuncTypeString(t *ast.FuncType) string {
 	if results == "" {
 		return fmt.Sprintf("func(%s)", params)
 	}
+	if len(t.Results.List) > 1 || len(t.Results.List[0].Names) > 0 {
+		return fmt.Sprintf("func(%s) (%s)", params, results)
+	}
 	return fmt.Sprintf("func(%s) %s", params, results)
 }
 
@@ -189,6 +208,8 @@ func deepCopy(src *Structure) *Structure {
 	elem := &Structure{
 		Name:        src.Name,
 		Path:        src.Path,
+		Scope:       src.Scope,
+		TypeID:      src.TypeID,
 		Root:        src.Root,
 		RootField:   src.RootField,
 		StructType:  src.StructType,
@@ -197,14 +218,21 @@ func deepCopy(src *Structure) *Structure {
 		Size:        src.Size,
 		Align:       src.Align,
 		Offset:      src.Offset,
+		Unknown:     src.Unknown,
 	}
 	if src.MetaData != nil {
 		elem.MetaData = &MetaData{
 			BeforeSize: src.MetaData.BeforeSize,
 			AfterSize:  src.MetaData.AfterSize,
+			MaxSize:    src.MetaData.MaxSize,
 			Data:       src.MetaData.Data,
 			StartPos:   src.MetaData.StartPos,
 			EndPos:     src.MetaData.EndPos,
+			guesses:    src.MetaData.guesses,
+		}
+		for _, inst := range src.MetaData.Instantiations {
+			copied := *inst
+			elem.MetaData.Instantiations = append(elem.MetaData.Instantiations, &copied)
 		}
 	}
 	if src.NestedFields != nil {
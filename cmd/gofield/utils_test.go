@@ -2,6 +2,7 @@ package main
 
 import (
 	"go/ast"
+	"go/parser"
 	"reflect"
 	"testing"
 )
@@ -38,6 +39,26 @@ func TestGetTypeString(t *testing.T) {
 			},
 			expected: "map[string]int",
 		},
+		{
+			name:     "interface",
+			expr:     mustParseExpr(t, "interface{ Close() error }"),
+			expected: "interface{Close() error}",
+		},
+		{
+			name:     "slice of structs",
+			expr:     mustParseExpr(t, "[]struct{ A, B int `json:\"a\"` }"),
+			expected: "[]struct{A, B int `json:\"a\"`}",
+		},
+		{
+			name:     "constraint",
+			expr:     mustParseExpr(t, "interface{ ~int | ~string }"),
+			expected: "interface{~int | ~string}",
+		},
+		{
+			name:     "multiple results",
+			expr:     mustParseExpr(t, "func() (int, error)"),
+			expected: "func() (int, error)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -50,6 +71,16 @@ func TestGetTypeString(t *testing.T) {
 	}
 }
 
+// mustParseExpr parses a Go expression.
+func mustParseExpr(t *testing.T, src string) ast.Expr {
+	t.Helper()
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
 // TestGetFuncTypeString tests the getFuncTypeString function.
 // It checks if the function correctly generates string representations
 // of function types with various parameters and return values.
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// verifyTestFile is the name of the test file added to packages with an overlay, it is never written to the package folder
+const verifyTestFile = "zz_gofield_verify_test.go"
+
+// verifyTestName is the name of the test printing the layouts computed by the compiler
+const verifyTestName = "TestGofieldVerify"
+
+// verifyPrefix starts the lines printed by the verification test
+const verifyPrefix = "gofield-verify"
+
+// compilerLayout is the layout of a structure as computed by the compiler
+type compilerLayout struct {
+	size    uintptr
+	align   uintptr
+	offsets map[string]uintptr
+	sizes   map[string]uintptr
+}
+
+// generateVerifyTest generates the source of a test printing the size, alignment, field offsets and field sizes
+// of the structures as computed by the compiler:
+//
+//	gofield-verify	User	24	8
+//	gofield-verify	User	ID	0	8
+//
+// Imports are aliased so they cannot conflict with declarations of the package.
+func generateVerifyTest(pkgName string, layouts []structLayout) ([]byte, int, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gofield verify. DO NOT EDIT.\n\npackage %s\n\n", pkgName)
+	fmt.Fprintf(&buf, "import (\n\tgofieldfmt \"fmt\"\n\tgofieldtesting \"testing\"\n\tgofieldunsafe \"unsafe\"\n)\n\n")
+	fmt.Fprintf(&buf, "func %s(t *gofieldtesting.T) {\n", verifyTestName)
+	count := 0
+	for _, layout := range layouts {
+		if layout.generic {
+			continue
+		}
+		value := layout.Type + "{}"
+		fmt.Fprintf(&buf, "\tgofieldfmt.Printf(\"%s\\t%s\\t%%d\\t%%d\\n\", gofieldunsafe.Sizeof(%s), gofieldunsafe.Alignof(%s))\n", verifyPrefix, layout.Type, value, value)
+		for _, field := range layout.Fields {
+			name := field.selector()
+			if name == "" {
+				continue
+			}
+			fmt.Fprintf(
+				&buf,
+				"\tgofieldfmt.Printf(\"%s\\t%s\\t%s\\t%%d\\t%%d\\n\", gofieldunsafe.Offsetof(%s.%s), gofieldunsafe.Sizeof(%s.%s))\n",
+				verifyPrefix, layout.Type, name, value, name, value, name,
+			)
+		}
+		count++
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot format verification test: %w", err)
+	}
+	return source, count, nil
+}
+
+// parseVerifyOutput parses the lines printed by the verification test, other lines are ignored.
+func parseVerifyOutput(output string) (map[string]*compilerLayout, error) {
+	layouts := make(map[string]*compilerLayout)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		if parts[0] != verifyPrefix || len(parts) < 4 {
+			continue
+		}
+		numbers := make([]uintptr, 0, 2)
+		for _, part := range parts[len(parts)-2:] {
+			number, err := strconv.ParseUint(part, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid verification output %q", scanner.Text())
+			}
+			numbers = append(numbers, uintptr(number))
+		}
+		layout, ok := layouts[parts[1]]
+		if !ok {
+			layout = &compilerLayout{offsets: make(map[string]uintptr), sizes: make(map[string]uintptr)}
+			layouts[parts[1]] = layout
+		}
+		if len(parts) == 4 {
+			layout.size, layout.align = numbers[0], numbers[1]
+		} else {
+			layout.offsets[parts[2]], layout.sizes[parts[2]] = numbers[0], numbers[1]
+		}
+	}
+	return layouts, scanner.Err()
+}
+
+// verifyLayout describes the differences of the computed layout of a structure with the compiler's one.
+func verifyLayout(layout structLayout, actual *compilerLayout) []string {
+	var mismatches []string
+	if layout.Size != actual.size {
+		mismatches = append(mismatches, fmt.Sprintf("size %d(b), compiler %d(b)", layout.Size, actual.size))
+	}
+	if layout.Align != actual.align {
+		mismatches = append(mismatches, fmt.Sprintf("align %d, compiler %d", layout.Align, actual.align))
+	}
+	for _, field := range layout.Fields {
+		name := field.selector()
+		offset, ok := actual.offsets[name]
+		if name == "" || !ok {
+			continue
+		}
+		if field.Offset != offset {
+			mismatches = append(mismatches, fmt.Sprintf("field %s offset %d, compiler %d", field.Name, field.Offset, offset))
+		}
+		if size := actual.sizes[name]; field.Size != size {
+			mismatches = append(mismatches, fmt.Sprintf("field %s size %d(b), compiler %d(b)", field.Name, field.Size, size))
+		}
+	}
+	return mismatches
+}
+
+// runVerifyTest runs the verification test in the package folder with the local Go toolchain.
+// The test file is added with an overlay, so the package folder is not modified. The hidden files of the folder
+// are removed with the overlay as well, e.g. previously generated assertions.
+func runVerifyTest(dir string, source []byte, hidden ...string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	tmpDir, err := os.MkdirTemp("", "gofield-verify")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	testPath := filepath.Join(tmpDir, verifyTestFile)
+	if err := os.WriteFile(testPath, source, 0644); err != nil {
+		return "", err
+	}
+	replace := map[string]string{filepath.Join(absDir, verifyTestFile): testPath}
+	for _, name := range hidden {
+		replace[filepath.Join(absDir, name)] = ""
+	}
+	overlay, err := json.Marshal(map[string]map[string]string{"Replace": replace})
+	if err != nil {
+		return "", err
+	}
+	overlayPath := filepath.Join(tmpDir, "overlay.json")
+	if err := os.WriteFile(overlayPath, overlay, 0644); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("go", "test", "-overlay", overlayPath, "-count=1", "-v", "-run", "^"+verifyTestName+"$", ".")
+	cmd.Dir = absDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("go test: %v\n%s", err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// runVerify runs the "verify" command: compares the computed layouts with the ones of the compiler.
+func runVerify(args []string) int {
+	fs := newCommandFlagSet("verify", "gofield verify [--files ./...] [--types A,B]")
+	discovery := addDiscoveryFlags(fs, ".")
+	typesFlag := fs.String("types", "", "Comma-separated list of structures to verify, by name or qualified name (default: all)")
+	typesFileFlag := addTypesFileFlag(fs)
+	if code, ok := parseCommandFlags(fs, args); !ok {
+		return code
+	}
+	if err := useTypesFile(*typesFileFlag); err != nil {
+		return commandErrorf("Cannot load types file: %v\n", err)
+	}
+
+	files, err := discovery.findFiles()
+	if err != nil {
+		return commandErrorf("%v\n", err)
+	}
+	packages, err := collectPackageLayouts(files, splitAndTrim(*typesFlag))
+	if err != nil {
+		return commandErrorf("%v\n", err)
+	}
+
+	verified, mismatched := 0, 0
+	var failedFiles []fileError
+	for _, pkg := range packages {
+		source, count, err := generateVerifyTest(pkg.name, pkg.layouts)
+		if err == nil && count == 0 {
+			continue
+		}
+		var output string
+		if err == nil {
+			output, err = runVerifyTest(pkg.dir, source)
+		}
+		var actual map[string]*compilerLayout
+		if err == nil {
+			actual, err = parseVerifyOutput(output)
+		}
+		if err != nil {
+			failedFiles = append(failedFiles, fileError{path: pkg.dir, err: err})
+			continue
+		}
+		for _, layout := range pkg.layouts {
+			actualLayout, ok := actual[layout.Type]
+			if !ok {
+				continue
+			}
+			verified++
+			mismatches := verifyLayout(layout, actualLayout)
+			for _, mismatch := range mismatches {
+				fmt.Printf("%s: %s\n", layout.location(), mismatch)
+			}
+			if len(mismatches) > 0 {
+				mismatched++
+			}
+		}
+	}
+
+	fmt.Printf("Verified %d structures, %d mismatches\n", verified, mismatched)
+	if len(failedFiles) > 0 {
+		printFailedFiles(failedFiles)
+		return exitCodeErrors
+	}
+	if mismatched > 0 {
+		return exitCodeFindings
+	}
+	return 0
+}
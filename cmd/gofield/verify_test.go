@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseVerifyOutput tests parsing of the layouts printed by the verification test.
+func TestParseVerifyOutput(t *testing.T) {
+	output := "=== RUN   TestGofieldVerify\n" +
+		"gofield-verify\tUser\t24\t8\n" +
+		"gofield-verify\tUser\tID\t0\t8\n" +
+		"gofield-verify\tUser\tName\t8\t16\n" +
+		"--- PASS: TestGofieldVerify (0.00s)\n"
+	layouts, err := parseVerifyOutput(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]*compilerLayout{
+		"User": {
+			size:    24,
+			align:   8,
+			offsets: map[string]uintptr{"ID": 0, "Name": 8},
+			sizes:   map[string]uintptr{"ID": 8, "Name": 16},
+		},
+	}
+	if !reflect.DeepEqual(layouts, expected) {
+		t.Errorf("parseVerifyOutput() = %+v; want %+v", layouts, expected)
+	}
+
+	if _, err := parseVerifyOutput("gofield-verify\tUser\tbig\t8\n"); err == nil {
+		t.Error("Expected an error for invalid output")
+	}
+}
+
+// TestVerifyLayout tests the detection of mismatches with the layouts of the compiler.
+func TestVerifyLayout(t *testing.T) {
+	layout := structLayout{
+		Size:  32,
+		Align: 8,
+		Fields: []fieldLayout{
+			{Name: "ID", Offset: 0, Size: 16},
+			{Name: "Name", Offset: 16, Size: 16},
+		},
+	}
+	actual := &compilerLayout{
+		size:    24,
+		align:   8,
+		offsets: map[string]uintptr{"ID": 0, "Name": 8},
+		sizes:   map[string]uintptr{"ID": 8, "Name": 16},
+	}
+	expected := []string{
+		"size 32(b), compiler 24(b)",
+		"field ID size 16(b), compiler 8(b)",
+		"field Name offset 16, compiler 8",
+	}
+	if mismatches := verifyLayout(layout, actual); !reflect.DeepEqual(mismatches, expected) {
+		t.Errorf("verifyLayout() = %q; want %q", mismatches, expected)
+	}
+}
+
+// TestVerifyCommand tests the verification of layouts with the local Go toolchain.
+func TestVerifyCommand(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":    "module example.com/verify\n\ngo 1.21\n",
+		"models.go": "package models\n\ntype User struct {\n\tActive bool\n\tID     int64\n\tName   string\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code := runVerify([]string{"--files", dir}); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), "gofield") {
+			t.Errorf("Verification must not write to the package folder, found %s", entry.Name())
+		}
+	}
+}
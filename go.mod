@@ -2,4 +2,12 @@ module github.com/t34-dev/go-field-alignment/v2
 
 go 1.22.4
 
-require github.com/t34-dev/go-text-replacer v1.3.4
+require (
+	github.com/bmatcuk/doublestar/v4 v4.10.2
+	github.com/dave/dst v0.27.3
+	github.com/t34-dev/go-text-replacer v1.3.4
+	golang.org/x/mod v0.22.0
+	golang.org/x/tools v0.29.0
+)
+
+require golang.org/x/sync v0.10.0 // indirect
@@ -6,14 +6,14 @@ import (
 )
 
 type Problem1 struct{}
-type Problem2 struct{}
+type Problem2 struct {
+}
 type Problem3 struct {
-	hello  string
-	hello2 string
+	hello, hello2 string
+	typer         bool
 	time.Time
 	time.Duration
 	time.Location
-	typer bool
 }
 
 type StructWithGenerics[T any] struct {
@@ -33,11 +33,10 @@ type (
 	}
 
 	S2 struct {
-		F3 string
-		F4 StructWithGenerics[int]
-		F5 StructWithMoreGenerics[int, float64, string]
-		F1 bool
-		F2 bool
+		F5     StructWithMoreGenerics[int, float64, string]
+		F3     string
+		F4     StructWithGenerics[int]
+		F1, F2 bool
 	}
 )
 
@@ -46,20 +45,20 @@ type STRs []string
 
 // Test comment
 type MyTest struct {
+	nameX    string
+	Problem1 struct {
+		I interface{}
+		S struct{}
+	}
+	a   bool // 1 byte
+	b   bool // 1 byte
 	App struct {
 		// LogLevel
 		LogLevel                  string        `yaml:"log_level" env-default:"info"` // 2 text
 		Name                      string        `yaml:"name" env-default:"ms-sso"`
-		TimeToConfirmRegistration time.Duration `yaml:"tim_to_confirm_registration" env-required:"24h"`
 		IsProduction              bool          `yaml:"is_production" env:"IS_PRODUCTION" yaml-default:"true"`
+		TimeToConfirmRegistration time.Duration `yaml:"tim_to_confirm_registration" env-required:"24h"`
 	} `yaml:"app"`
-	nameX    string
-	Problem1 struct {
-		I interface{}
-		S struct{}
-	}
-	a bool // 1 byte
-	b bool // 1 byte
 } /* some text
 dsdsd
 dsds
@@ -67,7 +66,8 @@ dsds
 
 type MyTest2 struct{}
 
-type MyTest3 struct{}
+type MyTest3 struct {
+}
 
 type MyTest4 struct{} // test
 
@@ -88,29 +88,29 @@ func Get() {
 
 // Unaligned Structures
 type SimpleGenericUnaligned[T any] struct {
+	Value T
 	Name  string
 	ID    int
-	Value T
 }
 
 type MultiParamUnaligned[T string, U Number] struct {
-	IsValid bool
 	First   T
 	Second  U
+	IsValid bool
 }
 
 type OuterUnaligned[T any, U comparable] struct {
+	Data     T
 	Nested   Inner[U]
 	Priority int
-	Data     T
 }
 
 type TreeNodeUnaligned[T any] struct {
+	Value  T
 	Left   *TreeNodeUnaligned[T]
 	Right  *TreeNodeUnaligned[T]
 	Depth  int
 	IsLeaf bool
-	Value  T
 }
 
 type SliceContainerUnaligned[T any] struct {
@@ -122,29 +122,29 @@ type SliceContainerUnaligned[T any] struct {
 
 // Aligned Structures
 type SimpleGenericAligned[T any] struct {
+	Value T
 	Name  string
 	ID    int
-	Value T
 }
 
 type MultiParamAligned[T any, U Number] struct {
-	IsValid bool
 	First   T
 	Second  U
+	IsValid bool
 }
 
 type OuterAligned[T any, U comparable] struct {
+	Data     T
 	Nested   Inner[U]
 	Priority int
-	Data     T
 }
 
 type TreeNodeAligned[T any] struct {
+	Value  T
 	Left   *TreeNodeAligned[T]
 	Right  *TreeNodeAligned[T]
 	Depth  int
 	IsLeaf bool
-	Value  T
 }
 
 type SliceContainerAligned[T any] struct {
@@ -160,6 +160,6 @@ type Number interface {
 }
 
 type Inner[T comparable] struct {
-	Value string
 	Key   T
+	Value string
 }